@@ -1,33 +1,158 @@
 module github.com/lavalamp-/ipv666
 
+go 1.27.1
+
 require (
-	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf
 	github.com/cyberdelia/go-metrics-graphite v0.0.0-20161219230853-39f87cc3b432
 	github.com/fatih/color v1.7.0
-	github.com/gobuffalo/buffalo-plugins v1.9.3 // indirect
-	github.com/gobuffalo/flect v0.0.0-20181210151238-24a2b68e0316 // indirect
 	github.com/gobuffalo/packr/v2 v2.0.0-rc.13
 	github.com/google/uuid v1.1.0
-	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.0
-	github.com/mattn/go-colorable v0.0.9 // indirect
-	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/mitchellh/go-homedir v1.0.0
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/pkg/errors v0.8.0
 	github.com/rcrowley/go-metrics v0.0.0-20181016184325-3113b8401b8a
-	github.com/spaolacci/murmur3 v0.0.0-20180118202830-f09979ecbc72 // indirect
-	github.com/spf13/afero v1.2.0 // indirect
 	github.com/spf13/cobra v0.0.3
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.3.1
 	github.com/stretchr/testify v1.3.0
 	github.com/vmihailenco/msgpack v4.0.2+incompatible
-	github.com/willf/bitset v1.1.9 // indirect
 	github.com/willf/bloom v2.0.3+incompatible
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
-	golang.org/x/sys v0.0.0-20181220204120-b00e65af1da0 // indirect
 	golang.org/x/time v0.0.0-20181108054448-85acf8d2951c
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/Masterminds/semver v1.4.2 // indirect
+	github.com/ajg/form v0.0.0-20160822230020-523a5da1a92f // indirect
+	github.com/armon/consul-api v0.0.0-20180202201655-eb2c6b5be1b6 // indirect
+	github.com/cockroachdb/apd v1.1.0 // indirect
+	github.com/cockroachdb/cockroach-go v0.0.0-20181001143604-e0a95dfd547c // indirect
+	github.com/codegangsta/negroni v1.0.0 // indirect
+	github.com/coreos/etcd v3.3.10+incompatible // indirect
+	github.com/coreos/go-etcd v2.0.0+incompatible // indirect
+	github.com/coreos/go-semver v0.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/fatih/structs v1.1.0 // indirect
+	github.com/fsnotify/fsnotify v1.4.7 // indirect
+	github.com/go-sql-driver/mysql v1.4.0 // indirect
+	github.com/gobuffalo/buffalo v0.13.0 // indirect
+	github.com/gobuffalo/buffalo-plugins v1.9.3 // indirect
+	github.com/gobuffalo/buffalo-pop v1.0.5 // indirect
+	github.com/gobuffalo/envy v1.6.11 // indirect
+	github.com/gobuffalo/events v1.1.8 // indirect
+	github.com/gobuffalo/fizz v1.0.12 // indirect
+	github.com/gobuffalo/flect v0.0.0-20181210151238-24a2b68e0316 // indirect
+	github.com/gobuffalo/genny v0.0.0-20181211165820-e26c8466f14d // indirect
+	github.com/gobuffalo/github_flavored_markdown v1.0.7 // indirect
+	github.com/gobuffalo/httptest v1.0.2 // indirect
+	github.com/gobuffalo/licenser v0.0.0-20181211173111-f8a311c51159 // indirect
+	github.com/gobuffalo/logger v0.0.0-20181127160119-5b956e21995c // indirect
+	github.com/gobuffalo/makr v1.1.5 // indirect
+	github.com/gobuffalo/mapi v1.0.1 // indirect
+	github.com/gobuffalo/meta v0.0.0-20181127070345-0d7e59dd540b // indirect
+	github.com/gobuffalo/mw-basicauth v1.0.3 // indirect
+	github.com/gobuffalo/mw-contenttype v0.0.0-20180802152300-74f5a47f4d56 // indirect
+	github.com/gobuffalo/mw-csrf v0.0.0-20180802151833-446ff26e108b // indirect
+	github.com/gobuffalo/mw-forcessl v0.0.0-20180802152810-73921ae7a130 // indirect
+	github.com/gobuffalo/mw-i18n v0.0.0-20180802152014-e3060b7e13d6 // indirect
+	github.com/gobuffalo/mw-paramlogger v0.0.0-20181005191442-d6ee392ec72e // indirect
+	github.com/gobuffalo/mw-tokenauth v0.0.0-20181001105134-8545f626c189 // indirect
+	github.com/gobuffalo/packd v0.0.0-20181212173646-eca3b8fd6687 // indirect
+	github.com/gobuffalo/packr v1.21.0 // indirect
+	github.com/gobuffalo/plush v3.7.32+incompatible // indirect
+	github.com/gobuffalo/plushgen v0.0.0-20181207152837-eedb135bd51b // indirect
+	github.com/gobuffalo/pop v4.8.4+incompatible // indirect
+	github.com/gobuffalo/release v1.1.6 // indirect
+	github.com/gobuffalo/shoulders v1.0.1 // indirect
+	github.com/gobuffalo/syncx v0.0.0-20181120194010-558ac7de985f // indirect
+	github.com/gobuffalo/tags v2.0.15+incompatible // indirect
+	github.com/gobuffalo/uuid v2.0.5+incompatible // indirect
+	github.com/gobuffalo/validate v2.0.3+incompatible // indirect
+	github.com/gobuffalo/x v0.0.0-20181007152206-913e47c59ca7 // indirect
+	github.com/gofrs/uuid v3.1.0+incompatible // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/gorilla/context v1.1.1 // indirect
+	github.com/gorilla/mux v1.6.2 // indirect
+	github.com/gorilla/pat v0.0.0-20180118222023-199c85a7f6d1 // indirect
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/gorilla/sessions v1.1.3 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/hpcloud/tail v1.0.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/jackc/fake v0.0.0-20150926172116-812a484cc733 // indirect
+	github.com/jackc/pgx v3.2.0+incompatible // indirect
+	github.com/jmoiron/sqlx v0.0.0-20180614180643-0dae4fefe7c0 // indirect
+	github.com/joho/godotenv v1.3.0 // indirect
+	github.com/karrick/godirwalk v1.7.7 // indirect
+	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	github.com/kr/pty v1.1.3 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/lib/pq v1.0.0 // indirect
+	github.com/markbates/deplist v1.0.5 // indirect
+	github.com/markbates/going v1.0.2 // indirect
+	github.com/markbates/grift v1.0.4 // indirect
+	github.com/markbates/hmax v1.0.0 // indirect
+	github.com/markbates/inflect v1.0.4 // indirect
+	github.com/markbates/oncer v0.0.0-20181203154359-bf2de49a0be2 // indirect
+	github.com/markbates/refresh v1.4.10 // indirect
+	github.com/markbates/safe v1.0.1 // indirect
+	github.com/markbates/sigtx v1.0.0 // indirect
+	github.com/markbates/willie v1.0.9 // indirect
+	github.com/mattn/go-colorable v0.0.9 // indirect
+	github.com/mattn/go-isatty v0.0.4 // indirect
+	github.com/mattn/go-sqlite3 v1.9.0 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.1 // indirect
+	github.com/mitchellh/mapstructure v1.1.2 // indirect
+	github.com/monoculum/formam v0.0.0-20180901015400-4e68be1d79ba // indirect
+	github.com/nicksnyder/go-i18n v1.10.0 // indirect
+	github.com/onsi/ginkgo v1.7.0 // indirect
+	github.com/onsi/gomega v1.4.3 // indirect
+	github.com/pelletier/go-toml v1.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rogpeppe/go-internal v1.0.0 // indirect
+	github.com/satori/go.uuid v1.2.0 // indirect
+	github.com/serenize/snaker v0.0.0-20171204205717-a683aaf2d516 // indirect
+	github.com/sergi/go-diff v1.0.0 // indirect
+	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24 // indirect
+	github.com/shurcooL/go v0.0.0-20180423040247-9e1955d9fb6e // indirect
+	github.com/shurcooL/go-goon v0.0.0-20170922171312-37c2f522c041 // indirect
+	github.com/shurcooL/highlight_diff v0.0.0-20170515013008-09bb4053de1b // indirect
+	github.com/shurcooL/highlight_go v0.0.0-20170515013102-78fb10f4a5f8 // indirect
+	github.com/shurcooL/octicon v0.0.0-20180602230221-c42b0e3b24d9 // indirect
+	github.com/shurcooL/sanitized_anchor_name v0.0.0-20170918181015-86672fcb3f95 // indirect
+	github.com/sirupsen/logrus v1.2.0 // indirect
+	github.com/sourcegraph/annotate v0.0.0-20160123013949-f4cad6c6324d // indirect
+	github.com/sourcegraph/syntaxhighlight v0.0.0-20170531221838-bd320f5d308e // indirect
+	github.com/spaolacci/murmur3 v0.0.0-20180118202830-f09979ecbc72 // indirect
+	github.com/spf13/afero v1.2.0 // indirect
+	github.com/spf13/cast v1.3.0 // indirect
+	github.com/spf13/jwalterweatherman v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
+	github.com/ugorji/go/codec v0.0.0-20181204163529-d75b2dcb6bc8 // indirect
+	github.com/unrolled/secure v0.0.0-20181005190816-ff9db2ff917f // indirect
+	github.com/willf/bitset v1.1.9 // indirect
+	github.com/xordataexchange/crypt v0.0.3-0.20170626215501-b2862e3d0a77 // indirect
+	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9 // indirect
+	golang.org/x/sync v0.0.0-20181108010431-42b317875d0f // indirect
+	golang.org/x/sys v0.0.0-20181220204120-b00e65af1da0 // indirect
+	golang.org/x/text v0.3.0 // indirect
 	golang.org/x/tools v0.0.0-20181221001348-537d06c36207 // indirect
+	google.golang.org/appengine v1.2.0 // indirect
+	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
+	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/errgo.v2 v2.1.0 // indirect
+	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
+	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df // indirect
+	gopkg.in/mail.v2 v2.0.0-20180731213649-a0242b2233b4 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -4,10 +4,8 @@ import (
 	"fmt"
 	"github.com/lavalamp-/ipv666/internal/addressing"
 	"github.com/lavalamp-/ipv666/internal/blacklist"
-	"github.com/lavalamp-/ipv666/internal/config"
-	"github.com/lavalamp-/ipv666/internal/fs"
 	"github.com/lavalamp-/ipv666/internal/logging"
-	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"net"
@@ -15,6 +13,8 @@ import (
 
 func RunAlias(targetNetworkString string) {
 
+	exitIfHalted()
+
 	_, targetNetwork, err := net.ParseCIDR(targetNetworkString)
 	if err != nil {
 		logging.ErrorF(err)
@@ -22,6 +22,7 @@ func RunAlias(targetNetworkString string) {
 
 	ip, aliased, err := checkNetworkForAliased(targetNetwork)
 
+	recordHalt(err)
 	if err != nil {
 		logging.ErrorF(err)
 	} else if !aliased {
@@ -32,6 +33,7 @@ func RunAlias(targetNetworkString string) {
 
 	aliasedNet, err := seekAliasedNetwork(targetNetwork, ip)
 
+	recordHalt(err)
 	if err != nil {
 		logging.ErrorF(err)
 	}
@@ -72,26 +74,16 @@ func seekAliasedNetwork(inputNet *net.IPNet, inputIP *net.IP) (*net.IPNet, error
 				scanAddrs = append(scanAddrs, testAddr)
 			}
 		}
-		targetsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
-		logging.Debugf("Writing %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-		err := addressing.WriteIPsToHexFile(targetsPath, scanAddrs)
+		logging.Debugf("Kicking off ping scan of %d blacklist scan addresses.", len(scanAddrs))
+		prober, err := probe.NewFromConfig(probe.PHASE_ALIAS)
 		if err != nil {
-			logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(scanAddrs), targetsPath, err)
 			return nil, err
 		}
-		logging.Debugf("Successfully wrote %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-		outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
-		logging.Debugf("Kicking off ping scan from file path '%s' to output path '%s'.", targetsPath, outputPath)
-		_, err = pingscan.ScanFromConfig(targetsPath, outputPath)
+		foundAddrs, err := probe.ProbeAddresses(prober, scanAddrs)
 		if err != nil {
 			logging.Warnf("An error was thrown when trying to run ping scan: %s", err)
 			return nil, err
 		}
-		foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
-		if err != nil {
-			logging.Warnf("Error thrown when reading IP addresses from file '%s': %e", outputPath, err)
-			return nil, err
-		}
 		logging.Debugf("%d addresses responded to ICMP pings.", len(foundAddrs))
 		foundAddrSet := addressing.GetIPSet(foundAddrs)
 		logging.Debugf("Updating check list with results from ping scan.")
@@ -125,31 +117,19 @@ func checkNetworkForAliased(inputNet *net.IPNet) (*net.IP, bool, error) {
 	logging.Infof("Now checking network range %s for aliased status.", inputNet)
 
 	addrs := addressing.GenerateRandomAddressesInNetwork(inputNet, viper.GetInt("NetworkPingCount"))
-	addrsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
 
-	logging.Debugf("Writing %d test addresses to file at path '%s'.", len(addrs), addrsPath)
+	logging.Debugf("Ping scanning %d test addresses.", len(addrs))
 
-	err := addressing.WriteIPsToHexFile(addrsPath, addrs)
+	prober, err := probe.NewFromConfig(probe.PHASE_ALIAS)
 	if err != nil {
-		logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(addrs), addrsPath, err)
 		return nil, false, err
 	}
-
-	logging.Debugf("Wrote test addresses to file at path '%s'.", addrsPath)
-	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
-
-	_, err = pingscan.ScanFromConfig(addrsPath, outputPath)
+	foundAddrs, err := probe.ProbeAddresses(prober, addrs)
 	if err != nil {
 		logging.Warnf("An error was thrown when trying to run ping scan: %s", err)
 		return nil, false, err
 	}
 
-	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
-	if err != nil {
-		logging.Warnf("Error thrown when reading IP addresses from file '%s': %e", outputPath, err)
-		return nil, false, err
-	}
-
 	threshold := (int)(float64(viper.GetInt("NetworkPingCount")) * viper.GetFloat64("NetworkBlacklistPercent"))
 	logging.Infof("Threshold for aliased network detection is %d (%d ping count, %f percent). %d addresses responded.", threshold, viper.GetInt("NetworkPingCount"), viper.GetFloat64("NetworkBlacklistPercent"), len(foundAddrs))
 
@@ -22,6 +22,8 @@ func RunDiscovery() {
 
 	targetNetwork, _ := config.GetTargetNetwork()
 
+	exitIfHalted()
+
 	mostRecentNetworkString, err := data.GetMostRecentTargetNetworkString()
 	if err != nil {
 		logging.ErrorStringFf("Error thrown when reading most recent network string: %e", err)
@@ -57,6 +59,7 @@ func RunDiscovery() {
 
 	//TODO push metrics
 
+	recordHalt(err)
 	if err != nil {
 		logging.ErrorF(err)
 	}
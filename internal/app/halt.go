@@ -0,0 +1,29 @@
+package app
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/probe"
+)
+
+// Exit if an earlier scan was halted for safety, as a network that objected to being scanned shouldn't be
+// probed again until somebody has looked into it
+func exitIfHalted() {
+	haltReason, err := data.GetHaltReason()
+	if err != nil {
+		logging.ErrorStringFf("Error thrown when reading halt file (path '%s'): %e", config.GetHaltFilePath(), err)
+	}
+	if haltReason != "" {
+		logging.ErrorStringFf("Scanning was previously halted for safety (%s). Delete the file at '%s' to resume scanning.", haltReason, config.GetHaltFilePath())
+	}
+}
+
+// Write the reason to the halt file if err is from a scan that was halted for safety
+func recordHalt(err error) {
+	if haltErr, ok := err.(*probe.HaltError); ok {
+		if err := data.WriteHaltReason(haltErr.Reason); err != nil {
+			logging.Warnf("Error thrown when writing halt file (path '%s'): %e", config.GetHaltFilePath(), err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/spf13/viper"
+	"net"
+)
+
+func RunLocalScan(genCount int) {
+
+	// The halt file isn't checked, as local scans only probe the on-link networks being audited and not
+	// the remote networks that a scan may have been halted for
+
+	// Candidates are generated within each on-link network as it is solicited
+	clusterModel, err := data.GetProbabilisticClusterModel()
+	if err != nil {
+		logging.ErrorF(err)
+	}
+	jitter := viper.GetFloat64("ModelGenerationJitter")
+	generate := func(prefix *net.IPNet) ([]*net.IP, error) {
+		if genCount == 0 {
+			return nil, nil
+		}
+		return clusterModel.GenerateAddressesFromNetwork(genCount, jitter, prefix)
+	}
+
+	resultsPath := fs.GetTimedFilePath(config.GetLocalResultDirPath())
+	found, err := pingscan.ScanLocalFromConfig(generate, resultsPath)
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	linkLocal := 0
+	for _, addr := range found {
+		if addr.IsLinkLocalUnicast() {
+			linkLocal++
+		}
+	}
+
+	// Addresses on the local link are never synced, as they belong to the network being audited
+	if len(found) > 0 {
+		if err := data.AppendToOutputFile(found); err != nil {
+			logging.ErrorF(err)
+		}
+	}
+
+	logging.Successf("Found %d addresses on the local link (%d link-local and %d global).", len(found), linkLocal, len(found) - linkLocal)
+	logging.Successf("Results were written to '%s' and addresses were added to '%s'.", resultsPath, config.GetOutputFilePath())
+
+}
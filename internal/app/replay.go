@@ -0,0 +1,26 @@
+package app
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/statemachine"
+)
+
+func RunReplay(capturePath string) {
+
+	// Record the network so that discovery picks up from the replayed results instead of starting over
+	targetNetwork, _ := config.GetTargetNetwork()
+	err := data.WriteMostRecentTargetNetwork(targetNetwork)
+	if err != nil {
+		logging.ErrorStringFf("Error thrown when writing most recent target network: %e", err)
+	}
+
+	err = statemachine.ReplayCandidateScan(capturePath)
+	if err != nil {
+		logging.ErrorStringFf("Error thrown when replaying packet capture at path '%s': %e", capturePath, err)
+	}
+
+	logging.Successf("Successfully replayed the packet capture at '%s' for network %s. Run 'ipv666 scan discover' with the same network to process the results.", capturePath, targetNetwork)
+
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/spf13/viper"
+	"net"
+)
+
+func RunTrace(inputPath string, genCount int) {
+
+	exitIfHalted()
+
+	var targets []*net.IP
+	var err error
+
+	if inputPath == "" {
+		targetNetwork, _ := config.GetTargetNetwork()
+		logging.Infof("No input file specified. Generating %d candidate addresses in %s to trace.", genCount, targetNetwork)
+		clusterModel, err := data.GetProbabilisticClusterModel()
+		if err != nil {
+			logging.ErrorF(err)
+		}
+		targets, err = clusterModel.GenerateAddressesFromNetwork(genCount, viper.GetFloat64("ModelGenerationJitter"), targetNetwork)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+	} else {
+		logging.Infof("Reading addresses to trace from file at path '%s'.", inputPath)
+		targets, err = fs.ReadIPsFromFile(inputPath)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+	}
+
+	if len(targets) == 0 {
+		logging.ErrorStringFf("There are no addresses to trace.")
+	}
+
+	routersPath := fs.GetTimedFilePath(config.GetTraceRouterDirPath())
+	pathsPath := fs.GetTimedFilePath(config.GetTracePathDirPath())
+	paths, err := pingscan.TraceFromConfig(targets, routersPath, pathsPath)
+
+	recordHalt(err)
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	reached := 0
+	for _, path := range paths.GetPaths() {
+		if path.Reached {
+			reached++
+		}
+	}
+
+	logging.Successf("Found %d routers on the paths to %d addresses (%d of which answered).", len(paths.GetRouters()), len(targets), reached)
+	logging.Successf("Router addresses were written to '%s' and paths to '%s'.", routersPath, pathsPath)
+
+}
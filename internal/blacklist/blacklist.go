@@ -71,6 +71,15 @@ func (blacklist *NetworkBlacklist) AddNetwork(toAdd *net.IPNet) (bool) {
 		return false
 	}
 
+	return blacklist.AddNetworkUnconditionally(toAdd)
+
+}
+
+// Add a network even if the addresses at either end of it are already blacklisted, which AddNetwork
+// takes to mean that the whole network is. Only a network that is already in the blacklist exactly
+// is skipped.
+func (blacklist *NetworkBlacklist) AddNetworkUnconditionally(toAdd *net.IPNet) (bool) {
+
 	netLen, _ := toAdd.Mask.Size()
 
 	// New len?
@@ -84,6 +93,9 @@ func (blacklist *NetworkBlacklist) AddNetwork(toAdd *net.IPNet) (bool) {
 	ip := [2]uint64{}
 	ip[0] = binary.BigEndian.Uint64(toAdd.IP[0:8])
 	ip[1] = binary.BigEndian.Uint64(toAdd.IP[8:16])
+	if _, ok := blacklist.nets[netLen].nets[ip]; ok {
+		return false
+	}
 	blacklist.nets[netLen].nets[ip] = struct{}{}
 
 	blacklist.count++
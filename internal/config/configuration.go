@@ -20,6 +20,8 @@ func InitConfig() {
 	viper.BindEnv("GeneratedModelDirectory")			// Subdirectory where statistical models are kept
 	viper.BindEnv("CandidateAddressDirectory")		// Subdirectory where generated candidate addressing are kept
 	viper.BindEnv("PingResultDirectory")				// Subdirectory where results of ping scans are kept
+	viper.BindEnv("PingErrorDirectory")				// Subdirectory where ICMPv6 errors received during ping scans are kept
+	viper.BindEnv("PacketCaptureDirectory")			// Subdirectory where packet captures of ping scans are kept
 	viper.BindEnv("NetworkGroupDirectory")			// Subdirectory where results of grouping live hosts are kept
 	viper.BindEnv("NetworkScanTargetsDirectory")		// Subdirectory where the addresses to scan for blacklist checks are kept
 	viper.BindEnv("NetworkScanResultsDirectory")		// Subdirectory where the results of scanning blacklist candidate networks are kept
@@ -27,8 +29,15 @@ func InitConfig() {
 	viper.BindEnv("CleanPingResultDirectory")		// Subdirectory where cleaned ping results are kept
 	viper.BindEnv("AliasedNetworkDirectory")			// Subdirectory where aliased network results are kept
 	viper.BindEnv("BloomFilterDirectory")			// Subdirectory where the Bloom filter is kept
+	viper.BindEnv("TraceRouterDirectory")			// Subdirectory where the router addresses found by traces are kept
+	viper.BindEnv("TracePathDirectory")				// Subdirectory where the paths to traced targets are kept
+	viper.BindEnv("LocalResultDirectory")			// Subdirectory where the results of local link scans are kept
 	viper.BindEnv("StateFileName")					// The file name for the file that contains the current state
 	viper.BindEnv("TargetNetworkFileName")			// The file name for the file that contains the last network that was targeted
+	viper.BindEnv("ExclusionFileName")				// The file name for the file that lists networks that must never be probed
+	viper.BindEnv("ExclusionLogFileName")			// The file name for the file that targets dropped for being in an excluded network are logged to
+	viper.BindEnv("HaltFileName")					// The file name for the file that records why scanning was halted for safety
+	viper.BindEnv("ScanCheckpointFileName")			// The file name for the file that records the progress of an in-flight candidate scan
 	viper.BindEnv("CloudSyncOptInPath")				// Cloud sync opt-in status file path
 	viper.BindEnv("CloudSyncOptIn")					// Cloud sync opt-in status
 
@@ -41,6 +50,8 @@ func InitConfig() {
 	viper.SetDefault("GeneratedModelDirectory", "models")
 	viper.SetDefault("CandidateAddressDirectory", "candidates")
 	viper.SetDefault("PingResultDirectory", "pingresult")
+	viper.SetDefault("PingErrorDirectory", "pingerror")
+	viper.SetDefault("PacketCaptureDirectory", "pcap")
 	viper.SetDefault("NetworkGroupDirectory", "networkgroups")
 	viper.SetDefault("NetworkScanTargetsDirectory", "networkscantargets")
 	viper.SetDefault("NetworkScanResultsDirectory", "networkscanresults")
@@ -48,16 +59,25 @@ func InitConfig() {
 	viper.SetDefault("CleanPingResultDirectory", "cleanpings")
 	viper.SetDefault("AliasedNetworkDirectory", "aliasednets")
 	viper.SetDefault("BloomFilterDirectory", "bloom")
+	viper.SetDefault("TraceRouterDirectory", "tracerouters")
+	viper.SetDefault("TracePathDirectory", "tracepaths")
+	viper.SetDefault("LocalResultDirectory", "localresults")
 	viper.SetDefault("StateFileName", "state.bin")
 	viper.SetDefault("TargetNetworkFileName", "network.bin")
+	viper.SetDefault("ExclusionFileName", "exclusions.txt")
+	viper.SetDefault("ExclusionLogFileName", "excluded.log")
+	viper.SetDefault("HaltFileName", "halt.txt")
+	viper.SetDefault("ScanCheckpointFileName", "scan_checkpoint.json")
 	viper.SetDefault("CloudSyncOptInPath", ".cloudsyncoptin")
 	viper.SetDefault("CloudSyncOptIn", false)
 
 	// Candidate address generation
 
 	viper.BindEnv("GenerateAddressCount")			// How many addressing to generate in a given iteration
+	viper.BindEnv("PipelineGenerateScan")			// Whether or not to ping scan candidate addresses as they are generated
 
 	viper.SetDefault("GenerateAddressCount", 1000000)
+	viper.SetDefault("PipelineGenerateScan", false)
 
 	// Modeling
 
@@ -130,10 +150,74 @@ func InitConfig() {
 	// Scanning
 
 	viper.BindEnv("PingScanBandwidth")				// The maximum bandwidth to use for ping scanning
+	viper.BindEnv("PingScanRate")					// The maximum packets per second to use for ping scanning (0 to use the bandwidth instead)
+	viper.BindEnv("PingScanInterface")				// The network interface to send probes out of and receive replies on (empty to let the kernel choose)
+	viper.BindEnv("PingScanSourceAddress")			// The IPv6 address to send probes from (empty to let the kernel choose)
+	viper.BindEnv("PingScanProbe")					// The kinds of probes to send to each target (a comma-separated list of "icmp", "tcp", "udp", and "param", or "both" for ICMP and TCP)
+	viper.BindEnv("PingScanTCPPorts")				// A comma-separated list of the ports to send TCP SYN probes to
+	viper.BindEnv("PingScanUDPPorts")				// A comma-separated list of the ports to send UDP probes to (any of 53, 123, and 161)
+	viper.BindEnv("PacketCaptureEnabled")			// Whether or not to write the probes sent and replies received in each state machine step to a pcap file
 	viper.BindEnv("ScanTargetNetwork")				// The default network to scan
+	viper.BindEnv("PingScanDrainTimeout")			// The number of seconds to keep listening for late replies after the last probe of a scan is sent
+	viper.BindEnv("PingScanRetryCount")				// The number of times to retry probing a target that has not responded
+	viper.BindEnv("PingScanRetryTimeout")			// The number of seconds to wait for a response before retrying a target
+	viper.BindEnv("PingScanSendRetryCount")			// The number of times to retry sending a probe that the network stack refused
+	viper.BindEnv("PingScanSendBackoff")			// The number of seconds to back off for after the first refused send, doubling on each retry
+	viper.BindEnv("PingScanBatchSize")				// The number of probes to send with a single system call
+	viper.BindEnv("PingScanSenderCount")			// The number of goroutines that build and send batches of probes
+	viper.BindEnv("PingScanAdaptiveRate")			// Whether or not to lower the probe rate when the network shows signs of congestion
+	viper.BindEnv("PingScanAdaptiveInterval")		// The number of seconds between adjustments of the probe rate
+	viper.BindEnv("PingScanAdaptiveMinRate")		// The lowest packets per second that the probe rate will be lowered to
+	viper.BindEnv("PingScanAdaptiveIncrease")		// The fraction of the maximum probe rate to add after each interval without congestion
+	viper.BindEnv("PingScanAdaptiveDecrease")		// The factor to multiply the probe rate by after an interval with congestion
+	viper.BindEnv("PingScanAdaptiveReplyDrop")		// The fractional drop in the share of answered probes that is taken as congestion
+	viper.BindEnv("PingScanAdaptiveErrorRise")		// The rise in the share of probes drawing ICMPv6 errors that is taken as congestion
+	viper.BindEnv("PingScanAdaptiveMinSamples")		// The number of probes that must be sent in an interval for reply rates to be considered
+	viper.BindEnv("PingScanHaltErrorRatio")			// The fraction of probes refused or drawing Administratively Prohibited, Reject Route, or policy errors at which a scan is halted (0 to disable)
+	viper.BindEnv("PingScanHaltPrefixObjections")	// The number of Administratively Prohibited, Reject Route, or policy errors from one prefix per interval at which a scan is halted (0 to disable)
+	viper.BindEnv("PingScanHaltSendFailures")		// The number of consecutive refused sends at which a scan is halted (0 to disable)
+	viper.BindEnv("PingScanHaltMinSamples")			// The number of probes that must be sent in an interval for the ICMPv6 error fraction to be considered
+	viper.BindEnv("PingScanHaltInterval")			// The number of seconds over which ICMPv6 errors are counted
+	viper.BindEnv("PingScanHaltPause")				// The number of seconds to pause a scan for the first time that it would be halted (0 to halt right away)
+	viper.BindEnv("PingScanPrefixLength")			// The prefix length that targets are grouped by when interleaving and rate limiting probes
+	viper.BindEnv("PingScanPrefixRate")				// The maximum packets per second to send to any one prefix (0 for no limit)
+	viper.BindEnv("PingScanSeed")					// The seed for the order that targets are scanned in (0 for a random seed each scan)
+	viper.BindEnv("PingScanCheckpointInterval")		// The number of seconds between checkpoints of candidate scan progress
 
 	viper.SetDefault("PingScanBandwidth", "20M")
+	viper.SetDefault("PingScanRate", 0)
+	viper.SetDefault("PingScanInterface", "")
+	viper.SetDefault("PingScanSourceAddress", "")
+	viper.SetDefault("PingScanProbe", "icmp")
+	viper.SetDefault("PingScanTCPPorts", "22,80,443")
+	viper.SetDefault("PingScanUDPPorts", "53,123,161")
+	viper.SetDefault("PacketCaptureEnabled", false)
 	viper.SetDefault("ScanTargetNetwork", "2000::/4")
+	viper.SetDefault("PingScanDrainTimeout", 5)
+	viper.SetDefault("PingScanRetryCount", 0)
+	viper.SetDefault("PingScanRetryTimeout", 2)
+	viper.SetDefault("PingScanSendRetryCount", 8)
+	viper.SetDefault("PingScanSendBackoff", 0.001)
+	viper.SetDefault("PingScanBatchSize", 64)
+	viper.SetDefault("PingScanSenderCount", 1)
+	viper.SetDefault("PingScanAdaptiveRate", false)
+	viper.SetDefault("PingScanAdaptiveInterval", 1)
+	viper.SetDefault("PingScanAdaptiveMinRate", 100)
+	viper.SetDefault("PingScanAdaptiveIncrease", 0.05)
+	viper.SetDefault("PingScanAdaptiveDecrease", 0.5)
+	viper.SetDefault("PingScanAdaptiveReplyDrop", 0.5)
+	viper.SetDefault("PingScanAdaptiveErrorRise", 0.1)
+	viper.SetDefault("PingScanAdaptiveMinSamples", 100)
+	viper.SetDefault("PingScanHaltErrorRatio", 0.9)
+	viper.SetDefault("PingScanHaltPrefixObjections", 1000)
+	viper.SetDefault("PingScanHaltSendFailures", 1000)
+	viper.SetDefault("PingScanHaltMinSamples", 1000)
+	viper.SetDefault("PingScanHaltInterval", 1)
+	viper.SetDefault("PingScanHaltPause", 0)
+	viper.SetDefault("PingScanPrefixLength", 48)
+	viper.SetDefault("PingScanPrefixRate", 1000)
+	viper.SetDefault("PingScanSeed", 0)
+	viper.SetDefault("PingScanCheckpointInterval", 10)
 
 	// Clean Up
 
@@ -187,6 +271,22 @@ func InitConfig() {
 	viper.SetDefault("AliasLeftIndexStart", 0)
 	viper.SetDefault("AliasDuplicateScanCount", 3)
 
+	// Tracing
+
+	viper.BindEnv("TraceMaxHops")					// The highest hop limit that trace probes are sent with
+	viper.BindEnv("TraceGenerateCount")				// The number of candidate addresses to generate and trace when no targets are given
+
+	viper.SetDefault("TraceMaxHops", 32)
+	viper.SetDefault("TraceGenerateCount", 10000)
+
+	// Local Scanning
+
+	viper.BindEnv("LocalScanGenerateCount")			// The number of candidate addresses to generate and solicit in each on-link /64 network (0 to only ping the link)
+	viper.BindEnv("LocalScanListenTimeout")			// The number of seconds to listen for replies after pinging the link and after the last Neighbor Solicitation
+
+	viper.SetDefault("LocalScanGenerateCount", 1000)
+	viper.SetDefault("LocalScanListenTimeout", 5)
+
 	// Syncing
 
 	viper.BindEnv("SyncTimeout")						// Amount of time in seconds to wait for timeouts when syncing data
@@ -220,6 +320,22 @@ func GetStateFilePath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("StateFileName"))
 }
 
+func GetExclusionFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("ExclusionFileName"))
+}
+
+func GetExclusionLogFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("ExclusionLogFileName"))
+}
+
+func GetHaltFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("HaltFileName"))
+}
+
+func GetScanCheckpointFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("ScanCheckpointFileName"))
+}
+
 func GetTargetNetworkFilePath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("TargetNetworkFileName"))
 }
@@ -236,6 +352,14 @@ func GetPingResultDirPath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("PingResultDirectory"))
 }
 
+func GetPingErrorDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("PingErrorDirectory"))
+}
+
+func GetPacketCaptureDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("PacketCaptureDirectory"))
+}
+
 func GetNetworkGroupDirPath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("NetworkGroupDirectory"))
 }
@@ -264,12 +388,26 @@ func GetBloomDirPath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("BloomFilterDirectory"))
 }
 
+func GetTraceRouterDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("TraceRouterDirectory"))
+}
+
+func GetTracePathDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("TracePathDirectory"))
+}
+
+func GetLocalResultDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("LocalResultDirectory"))
+}
+
 func GetAllDirectories() []string {
 	return []string{
 		viper.GetString("BaseOutputDirectory"),
 		GetGeneratedModelDirPath(),
 		GetCandidateAddressDirPath(),
 		GetPingResultDirPath(),
+		GetPingErrorDirPath(),
+		GetPacketCaptureDirPath(),
 		GetNetworkGroupDirPath(),
 		GetNetworkScanTargetsDirPath(),
 		GetNetworkScanResultsDirPath(),
@@ -277,6 +415,9 @@ func GetAllDirectories() []string {
 		GetCleanPingDirPath(),
 		GetAliasedNetworkDirPath(),
 		GetBloomDirPath(),
+		GetTraceRouterDirPath(),
+		GetTracePathDirPath(),
+		GetLocalResultDirPath(),
 	}
 }
 
@@ -285,6 +426,8 @@ func GetAllExportDirectories() []string {
 		GetGeneratedModelDirPath(),
 		GetCandidateAddressDirPath(),
 		GetPingResultDirPath(),
+		GetPingErrorDirPath(),
+		GetPacketCaptureDirPath(),
 		GetNetworkGroupDirPath(),
 		GetNetworkScanTargetsDirPath(),
 		GetNetworkScanResultsDirPath(),
@@ -299,6 +442,52 @@ func GetGraphiteEmitDuration() time.Duration {
 	return time.Duration(viper.GetInt64("GraphiteEmitFreq")) * time.Second
 }
 
+func GetPingScanDrainDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanDrainTimeout") * float64(time.Second))
+}
+
+func GetLocalScanListenDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("LocalScanListenTimeout") * float64(time.Second))
+}
+
+func GetPingScanRetryDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanRetryTimeout") * float64(time.Second))
+}
+
+func GetPingScanSendBackoffDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanSendBackoff") * float64(time.Second))
+}
+
+func GetPingScanBatchSize() int {
+	if size := viper.GetInt("PingScanBatchSize"); size > 0 {
+		return size
+	}
+	return 1
+}
+
+func GetPingScanSenderCount() int {
+	if count := viper.GetInt("PingScanSenderCount"); count > 0 {
+		return count
+	}
+	return 1
+}
+
+func GetPingScanAdaptiveDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanAdaptiveInterval") * float64(time.Second))
+}
+
+func GetPingScanHaltDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanHaltInterval") * float64(time.Second))
+}
+
+func GetPingScanHaltPauseDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanHaltPause") * float64(time.Second))
+}
+
+func GetPingScanCheckpointDuration() time.Duration {
+	return time.Duration(viper.GetFloat64("PingScanCheckpointInterval") * float64(time.Second))
+}
+
 func GetTargetNetwork() (*net.IPNet, error) {
 	_, network, err := net.ParseCIDR(viper.GetString("ScanTargetNetwork"))
 	return network, err
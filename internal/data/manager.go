@@ -1,6 +1,7 @@
 package data
 
 import (
+	"bufio"
 	"bytes"
 	"compress/zlib"
 	"errors"
@@ -13,12 +14,14 @@ import (
 	"github.com/lavalamp-/ipv666/internal/fs"
 	"github.com/lavalamp-/ipv666/internal/logging"
 	"github.com/lavalamp-/ipv666/internal/modeling"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/spf13/viper"
 	"github.com/willf/bloom"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var curCandidatePingResults []*net.IP
@@ -57,6 +60,47 @@ func WriteMostRecentTargetNetwork(toWrite *net.IPNet) error {
 	return addressing.WriteIPv6NetworksToFile(config.GetTargetNetworkFilePath(), []*net.IPNet{toWrite})
 }
 
+// Get the reason that scanning was last halted for safety, returning an empty string if scanning
+// has not been halted
+func GetHaltReason() (string, error) {
+	if !fs.CheckIfFileExists(config.GetHaltFilePath()) {
+		return "", nil
+	}
+	content, err := ioutil.ReadFile(config.GetHaltFilePath())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func WriteHaltReason(reason string) error {
+	return ioutil.WriteFile(config.GetHaltFilePath(), []byte(reason + "\n"), 0644)
+}
+
+// Append addresses to the output file in the configured output format
+func AppendToOutputFile(addrs []*net.IP) error {
+	file, err := os.OpenFile(config.GetOutputFilePath(), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	if viper.GetString("OutputFileType") != "bin" {
+		if !(viper.GetString("OutputFileType") == "txt") { //TODO figure out why the != check fails but this works
+			logging.Warnf("Unexpected file format for output (%s). Defaulting to text.", viper.GetString("OutputFileType"))
+		}
+		for _, addr := range addrs {
+			writer.WriteString(fmt.Sprintf("%s\n", addr))
+		}
+	} else {
+		for _, addr := range addrs {
+			toWrite := ([]byte)(*addr)
+			writer.Write(toWrite)
+		}
+	}
+	return writer.Flush()
+}
+
 func UpdateAliasedNetworks(nets []*net.IPNet, filePath string) {
 	curAliasedNetworks = nets
 	curAliasedNetworksPath = filePath
@@ -290,7 +334,7 @@ func GetCandidatePingResults() ([]*net.IP, error) {
 		return curCandidatePingResults, nil
 	} else {
 		logging.Debugf("Loading candidate ping results from path '%s'.", filePath)
-		toReturn, err := fs.ReadIPsFromHexFile(filePath)
+		toReturn, err := probe.ReadLiveAddrsFromRecordFile(filePath)
 		if err == nil {
 			UpdateCandidatePingResults(toReturn, filePath)
 		}
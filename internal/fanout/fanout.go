@@ -1,22 +1,15 @@
 package fanout
 
 import (
-  "context"
-  "fmt"
-  "github.com/alecthomas/units"
   "github.com/lavalamp-/ipv666/internal/logging"
   "github.com/lavalamp-/ipv666/internal/data"
   "github.com/lavalamp-/ipv666/internal/addressing"
   "github.com/lavalamp-/ipv666/internal/fs"
   "github.com/lavalamp-/ipv666/internal/config"
+  "github.com/lavalamp-/ipv666/internal/probe"
   "github.com/spf13/viper"
-  "golang.org/x/net/icmp"
-  "golang.org/x/net/ipv6"
-  "golang.org/x/time/rate"
   "net"
   "os"
-  "sync/atomic"
-  "time"
 )
 
 func Slash64s(bandwidth string) error {
@@ -31,187 +24,151 @@ func NybbleAdjacent(bandwidth string) error {
 
 func fanOut(bandwidth string, slash64FanOut bool, nybbleFanOut bool) (string, error) {
 
-  // Instantiate ICMPv6 packet listener
-  listener, err := net.ListenPacket("ip6:58", "::")
+  bloom, err := data.GetBloomFilter()
   if err != nil {
-    logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
     return "", err
   }
-
-  // Instantiate IPv6 packet connection
-  conn := ipv6.NewPacketConn(listener)
-  if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
-    logging.Warnf("Error thrown when setting control message: %s", err.Error())
+  blacklist, err := data.GetBlacklist()
+  if err != nil {
     return "", err
   }
 
-  // Apply ICMP echo reply filter
-  var filter ipv6.ICMPFilter
-  filter.SetAll(true)
-  filter.Accept(ipv6.ICMPTypeEchoReply)
-  if err := conn.SetICMPFilter(&filter); err != nil {
-    logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+  // Output file
+  outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
+  file, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY, 0644)
+  if err != nil {
     return "", err
   }
+  defer file.Close()
+  errorPath := fs.GetTimedFilePath(config.GetPingErrorDirPath())
+  errFile, err := os.OpenFile(errorPath, os.O_CREATE|os.O_WRONLY, 0644)
+  if err != nil {
+    return "", err
+  }
+  defer errFile.Close()
 
-  // Ping configuration
-  // - 10-byte payload
-  // - 255-hop limit
-  echoData := []byte("0123456789")
-  wcm := &ipv6.ControlMessage{HopLimit: 255}
-
-  // Use the zmap kp/s rates to estimate our bandwidth-constrained ping rate
-  maxBandwidthInt, err := units.ParseBase2Bytes(bandwidth)
-  targetRate := float64(maxBandwidthInt) / 1e6 * 1300
-  rateLimit := rate.Limit(targetRate)
-  rateLimiter := rate.NewLimiter(rateLimit, 10)
-  ctx := context.Background()
-
-  // Kick off the receive processor
-  outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
-  hitCount := uint64(0)
-  ips :=  make(chan net.IPAddr)
-  newIps := make(map[string]struct{})
-  go processReplies(conn, outputPath, newIps, &hitCount)
-
-  // Generate neighboring networks
-  done := make(chan bool, 1)
-  go func(newIps map[string]struct{}) {
-
-    if slash64FanOut == true {
+  phase := probe.PHASE_NYBBLE_FANOUT
+  if slash64FanOut {
+    phase = probe.PHASE_SLASH64_FANOUT
+  }
+  prober, err := probe.NewEngine(phase, bandwidth, config.GetPingScanDrainDuration())
+  if err != nil {
+    return "", err
+  }
+  rxIps := make(map[string]struct{})
 
-      // Generate neighboring /64s
-      netIps := make(map[*net.IP]struct{})
-      err := generateNeighboring64Networks(ips, netIps)
-      if err != nil {
-        return
-      }
+  // Drops targets that are blacklisted or that have already been scanned
+  filter := func(ip *net.IP) bool {
+    return !blacklist.IsIPBlacklisted(ip) && !bloom.Test(*ip)
+  }
 
-      // Wait until the networks are all processed
-      for len(ips) > 0 {
-        logging.Debugf("Fan-out has %d networks remaining", len(ips))
-        time.Sleep(1*time.Second)
-      }
-      time.Sleep(2*time.Second)
+  // Records targets as scanned once they have been handed to the prober
+  scanned := func(ip *net.IP) {
+    bloom.Add(*ip)
+  }
 
-      // Generate neighboring /64s
-      err = generate64NetworkHosts(ips, netIps, newIps)
-      if err != nil {
-        return
-      }
+  if slash64FanOut == true {
 
-      // Wait until they are all processed
-      for len(ips) > 0 {
-        logging.Debugf("Fan-out has %d networks remaining", len(ips))
-        time.Sleep(1*time.Second)
-      }
-      time.Sleep(1*time.Second)
+    // Generate neighboring /64s
+    netIps := make(map[*net.IP]struct{})
+    newIps, err := fanOutRound(prober, filter, scanned, file, errFile, rxIps, func(ips chan<- *net.IP) error {
+      return generateNeighboring64Networks(ips, netIps)
+    })
+    if err != nil {
+      return "", err
+    }
 
+    // Generate hosts within the discovered /64s
+    _, err = fanOutRound(prober, filter, scanned, file, errFile, rxIps, func(ips chan<- *net.IP) error {
+      return generate64NetworkHosts(ips, netIps, newIps)
+    })
+    if err != nil {
+      return "", err
     }
 
-    if nybbleFanOut == true {
+  }
 
-      // Generate addresses
-      err := generateNybbleAdjacentAddrs(ips)
-      if err != nil {
-        return
-      }
+  if nybbleFanOut == true {
 
-      // Wait until the networks are all processed
-      for len(ips) > 0 {
-        logging.Debugf("Fan-out has %d networks remaining", len(ips))
-        time.Sleep(1*time.Second)
-      }
-      time.Sleep(2*time.Second) 
+    // Generate addresses
+    _, err := fanOutRound(prober, filter, scanned, file, errFile, rxIps, func(ips chan<- *net.IP) error {
+      return generateNybbleAdjacentAddrs(ips)
+    })
+    if err != nil {
+      return "", err
     }
+  }
+
+  // Exit
+  return "", nil
+}
 
 
-    done <- true    
-  }(newIps)
+func fanOutRound(prober probe.Prober, filter func(*net.IP) bool, scanned func(*net.IP), file *os.File, errFile *os.File, rxIps map[string]struct{}, generate func(chan<- *net.IP) error) (map[string]struct{}, error) {
 
-  bloom, err := data.GetBloomFilter()
+  // Kick off the prober
+  targets := make(chan *net.IP)
+  results, err := prober.Probe(targets)
   if err != nil {
-    return "", err
+    return nil, err
   }
-  blacklist, err := data.GetBlacklist()
-  if err != nil {
-    return "", err
-  }
-
-  // Ping each address
-  seq := uint16(0)
-  lastSecondCount := uint64(0)
-  count := uint64(0)
-  lastStatus := time.Now().Unix()
-  for len(ips) > 0 || len(done) == 0 {
-
-    // Attempt to read from ips with a 1 second timeout
-    select {
-
-      // Read
-      case ip := <-ips:
-       
-        if blacklist.IsIPBlacklisted(&ip.IP) {
-          continue
-        } else if bloom.Test(ip.IP) {
-          continue
-        } else {
-          bloom.Add(ip.IP)
-        }
-
-        // Rate limit outgoing connections
-        rateLimiter.Wait(ctx)
 
-        // Build the packet
-        ping := icmp.Message{
-          Type: ipv6.ICMPTypeEchoRequest,
-          Code: 0,
-          Body: &icmp.Echo{ID: int(seq), Seq: int(seq), Data: echoData},
-        }
-        req, err := ping.Marshal(nil)
-        if err != nil {
-          logging.Warnf("error encoding ICMP echo packet with destination %s (%s)", ip, err)
-          return "", err
+  // Generate the addresses to scan, dropping any that shouldn't be scanned. Generation carries on
+  // if the scan is halted, but its addresses are no longer filtered or handed to the prober.
+  genErr := make(chan error, 1)
+  stop := make(chan struct{})
+  go func() {
+    ips := make(chan *net.IP)
+    go func() {
+      genErr <- generate(ips)
+      close(ips)
+    }()
+    for ip := range ips {
+      select {
+      case <-stop:
+        continue
+      default:
+      }
+      if filter(ip) {
+        select {
+        case targets <- ip:
+          scanned(ip)
+        case <-stop:
         }
-        seq += 1
-
-        // Send the packet
-        _, werr := conn.WriteTo(req, wcm, &ip)
-        if werr != nil {
+      }
+    }
+    close(targets)
+  }()
 
-          // Requeue the packet if it failed (i.e. due to network buffer backpressure)
-          go func() { ips <- ip }()
-          continue
-        }
+  // Process the responses
+  newIps := make(map[string]struct{})
+  for result := range results {
 
-        // Increment the counter
-        lastSecondCount += 1
-        count += 1
-        t := time.Now().Unix()
-        if t != lastStatus {
-          lastStatus = t
-          logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", count, atomic.LoadUint64(&hitCount), lastSecondCount)
-          lastSecondCount = 0
-        }
+    if result.IsError() {
+      probe.WriteRecord(errFile, result)
+      continue
+    }
+    newIps[result.Addr.String()] = struct{}{}
 
-      // Timeout 
-      case <- time.After(1*time.Second):
-        continue
+    // Deduplicate received packets
+    if _, ok := rxIps[result.Addr.String()]; !ok {
+      rxIps[result.Addr.String()] = struct{}{}
+      probe.WriteRecord(file, result)
+      file.Sync()
+      logging.Debugf("receiver got response from %s", result.Addr)
     }
   }
+  close(stop)
 
-  // Close handle to stop the packet processor
-  conn.Close()
-
-  // Close the listener
-  listener.Close()
-
-  // Exit
-  return "", err
+  if err := prober.Err(); err != nil {
+    <-genErr
+    return nil, err
+  }
+  return newIps, <-genErr
 }
 
 
-func generateNybbleAdjacentAddrs(ips chan net.IPAddr) error {
+func generateNybbleAdjacentAddrs(ips chan<- *net.IP) error {
 
   // Load the discovered addresses
   cleanPings, err := data.GetCleanPingResults()
@@ -247,14 +204,14 @@ func generateNybbleAdjacentAddrs(ips chan net.IPAddr) error {
     return err
   }
   for _, v := range addrs {
-    ips <- net.IPAddr{ IP: *v }
+    ips <- v
   }
 
   return nil
 }
 
 
-func generate64NetworkHosts(ips chan net.IPAddr, netIps map[*net.IP]struct{}, newIps map[string]struct{}) error {
+func generate64NetworkHosts(ips chan<- *net.IP, netIps map[*net.IP]struct{}, newIps map[string]struct{}) error {
 
   logging.Infof("Fanning out from %d discovered /64 networks (host disovery)", (len(netIps) + len(newIps)))
 
@@ -283,9 +240,9 @@ func generate64NetworkHosts(ips chan net.IPAddr, netIps map[*net.IP]struct{}, ne
           break
         }
       }
-      ip := net.IP(seed)
+      ip := copyIP(seed)
       if _, ok := genIps[ip.String()]; !ok {
-        ips <- net.IPAddr{ IP: ip }
+        ips <- &ip
         genIps[ip.String()] = struct{}{}
         count += 1
       }
@@ -300,7 +257,7 @@ func generate64NetworkHosts(ips chan net.IPAddr, netIps map[*net.IP]struct{}, ne
 }
 
 
-func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struct{}) error {
+func generateNeighboring64Networks(ips chan<- *net.IP, netIps map[*net.IP]struct{}) error {
 
   // Load the discovered addresses
   cleanPings, err := data.GetCleanPingResults()
@@ -325,8 +282,8 @@ func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struc
   count := 0
   for k, _ := range netIps {
 
-    seedUp := net.IP(*k)
-    seedDown := net.IP(*k)
+    seedUp := copyIP(*k)
+    seedDown := copyIP(*k)
 
     // Generate $blockSize addresses
     for x := 0; x < blockSize; x++ {
@@ -337,9 +294,9 @@ func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struc
         }
       }
 
-      ip := net.IP(seedUp)
+      ip := copyIP(seedUp)
       if _, ok := genIps[ip.String()]; !ok {
-        ips <- net.IPAddr{ IP: ip }
+        ips <- &ip
         genIps[ip.String()] = struct{}{}
         count += 1
       }
@@ -354,9 +311,9 @@ func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struc
         }
       }
 
-      ip := net.IP(seedDown)
+      ip := copyIP(seedDown)
       if _, ok := genIps[ip.String()]; !ok {
-        ips <- net.IPAddr{ IP: ip }
+        ips <- &ip
         genIps[ip.String()] = struct{}{}
         count += 1
       }
@@ -371,57 +328,8 @@ func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struc
 }
 
 
-func processReplies(conn *ipv6.PacketConn, outputPath string, newIps map[string]struct{}, hitCount *uint64) {
-
-  // Output file
-  file, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY, 0644) 
-  if err != nil {
-    logging.ErrorF(err)
-    return
-  }
-  defer file.Close()
-
-  // Receive loop
-  rxIps := make(map[string]struct{})
-  buff := make([]byte, 1500)
-  for {
-
-    // Read the next ping response
-    rlen, _, raddr, rerr := conn.ReadFrom(buff)
-    if rerr != nil {
-
-      // Read timeout
-      if nerr, ok := rerr.(net.Error); ok && nerr.Timeout() {
-        continue
-      }
-
-      // Temporary error
-      nerr, ok := rerr.(*net.OpError)
-      if ok && nerr.Temporary() {
-        continue
-      }
-
-      // Permanent error
-      break
-    }
-
-    newIps[raddr.String()] = struct{}{}
-
-    // Deduplicate received packets
-    if _, ok := rxIps[raddr.String()]; !ok {
-
-      // Parse the response
-      rm, err := icmp.ParseMessage(58, buff[:rlen])
-      if err != nil {
-        logging.ErrorF(err)
-      }
-      atomic.AddUint64(hitCount, 1)
-      fmt.Fprintf(file, "%s\n", raddr.String())
-      file.Sync()
-      logging.Debugf("receiver got response from %s %v (%v)", raddr, buff[:rlen], rm)
-    }
-
-    continue
-  }
+func copyIP(toCopy net.IP) net.IP {
+  toReturn := make(net.IP, len(toCopy))
+  copy(toReturn, toCopy)
+  return toReturn
 }
-
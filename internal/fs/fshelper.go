@@ -54,7 +54,7 @@ func GetMostRecentFileFromDirectory(dirPath string) (string, error) {
 	var newestTime int64 = 0
 	for _, fi := range files {
 		if fi.Mode().IsRegular() {
-			curTime := fi.ModTime().Unix()
+			curTime := fi.ModTime().UnixNano()
 			if curTime > newestTime {
 				newestTime = curTime
 				newestFile = fi.Name()
@@ -176,7 +176,7 @@ func DeleteAllFilesInDirectory(dirPath string, omitPaths []string) (int, int, er
 }
 
 func GetTimedFilePath(baseDir string) string {
-	curTime := strconv.FormatInt(time.Now().Unix(), 10)
+	curTime := strconv.FormatInt(time.Now().UnixNano(), 10)
 	return filepath.Join(baseDir, curTime)
 }
 
@@ -104,24 +104,39 @@ func (clusterModel *ClusterModel) GenerateAddressesFromNetwork(generateCount int
 }
 
 func (clusterModel *ClusterModel) GenerateAddressesFromNetworkWithCallback(generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) ([]*net.IP, error) {
+	var toReturn []*net.IP
+	err := clusterModel.StreamAddressesFromNetwork(generateCount, jitter, network, fn, func(newIP *net.IP) error {
+		toReturn = append(toReturn, newIP)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
+
+// Generate generateCount addresses within network, passing each address that is not filtered out by fn
+// to emit instead of collecting them in memory
+func (clusterModel *ClusterModel) StreamAddressesFromNetwork(generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc, emit func(*net.IP) error) error {
 	ones, _ := network.Mask.Size()
 	if ones % 4 != 0 {
-		return nil, fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
+		return fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
 	}
 	networkNybbles := addressing.GetNybblesFromNetwork(network)
-	var toReturn []*net.IP
-	iteration := 0
-	for len(toReturn) < generateCount {
+	emitted := 0
+	for emitted < generateCount {
 		newIP := clusterModel.generateAddressFromNybbles(jitter, networkNybbles)
 		isFiltered, err := fn(newIP)
 		if err != nil {
-			return nil, err
+			return err
 		} else if !isFiltered {
-			toReturn = append(toReturn, newIP)
+			if err := emit(newIP); err != nil {
+				return err
+			}
+			emitted++
 		}
-		iteration++
 	}
-	return toReturn, nil
+	return nil
 }
 
 func (clusterModel *ClusterModel) GenerateAddress(jitter float64) *net.IP {
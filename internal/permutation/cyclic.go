@@ -0,0 +1,134 @@
+package permutation
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+)
+
+// The largest set that can be permuted. The group's prime is the smallest prime above the set size,
+// which for this size is 2^32 - 5, the largest prime below 2^32. Keeping the prime below 2^32 means
+// that products of group elements always fit in a uint64.
+const MaxSize = (1 << 32) - 6
+
+// Cyclic walks a pseudo-random permutation of the integers [0, size) by iterating over the
+// multiplicative group of integers modulo a prime p > size, in the same manner as zmap. Only a
+// constant amount of state is kept regardless of the size of the set.
+type Cyclic struct {
+	size			uint64
+	prime			uint64
+	generator		uint64
+	first			uint64
+	current			uint64
+	position		uint64
+	done			bool
+}
+
+// Create a permutation of [0, size) determined by seed
+func NewCyclic(size uint64, seed int64) (*Cyclic, error) {
+	if size > MaxSize {
+		return nil, errors.New(fmt.Sprintf("Cannot permute a set of %d elements (maximum is %d).", size, uint64(MaxSize)))
+	}
+	random := rand.New(rand.NewSource(seed))
+	prime := nextPrime(size)
+	first := uint64(1)
+	if prime > 2 {
+		first = uint64(random.Int63n(int64(prime - 1))) + 1
+	}
+	return &Cyclic{
+		size:			size,
+		prime:			prime,
+		generator:		findGenerator(prime, random),
+		first:			first,
+		current:		first,
+		done:			size == 0,
+	}, nil
+}
+
+// Get the next element of the permutation. Returns false once the walk is complete.
+func (cyclic *Cyclic) Next() (uint64, bool) {
+	for !cyclic.done {
+		element := cyclic.current
+		cyclic.current = (cyclic.current * cyclic.generator) % cyclic.prime
+		if cyclic.current == cyclic.first {
+			cyclic.done = true
+		}
+
+		// Group elements are in [1, p), so skip those that don't map into [0, size)
+		if element > cyclic.size {
+			continue
+		}
+		cyclic.position++
+		return element - 1, true
+	}
+	return 0, false
+}
+
+// Get the number of elements of the full permutation that have been walked past so far
+func (cyclic *Cyclic) GetPosition() uint64 {
+	return cyclic.position
+}
+
+// Get the smallest prime that is greater than n
+func nextPrime(n uint64) uint64 {
+	candidate := n + 1
+	if candidate < 2 {
+		candidate = 2
+	}
+	for !new(big.Int).SetUint64(candidate).ProbablyPrime(0) {
+		candidate++
+	}
+	return candidate
+}
+
+// Get the distinct prime factors of n
+func primeFactors(n uint64) []uint64 {
+	var toReturn []uint64
+	for factor := uint64(2); factor * factor <= n; factor++ {
+		if n % factor == 0 {
+			toReturn = append(toReturn, factor)
+			for n % factor == 0 {
+				n /= factor
+			}
+		}
+	}
+	if n > 1 {
+		toReturn = append(toReturn, n)
+	}
+	return toReturn
+}
+
+func modPow(base uint64, exponent uint64, modulus uint64) uint64 {
+	result := uint64(1)
+	base %= modulus
+	for exponent > 0 {
+		if exponent & 1 == 1 {
+			result = (result * base) % modulus
+		}
+		base = (base * base) % modulus
+		exponent >>= 1
+	}
+	return result
+}
+
+// Pick a random generator of the multiplicative group of integers modulo prime
+func findGenerator(prime uint64, random *rand.Rand) uint64 {
+	if prime <= 3 {
+		return prime - 1
+	}
+	factors := primeFactors(prime - 1)
+	for {
+		candidate := uint64(random.Int63n(int64(prime - 2))) + 2
+		isGenerator := true
+		for _, factor := range factors {
+			if modPow(candidate, (prime - 1) / factor, prime) == 1 {
+				isGenerator = false
+				break
+			}
+		}
+		if isGenerator {
+			return candidate
+		}
+	}
+}
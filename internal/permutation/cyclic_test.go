@@ -0,0 +1,50 @@
+package permutation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func walk(cyclic *Cyclic) []uint64 {
+	var toReturn []uint64
+	for {
+		element, ok := cyclic.Next()
+		if !ok {
+			return toReturn
+		}
+		toReturn = append(toReturn, element)
+	}
+}
+
+func TestCyclic_VisitsEveryElementOnce(t *testing.T) {
+	for _, size := range []uint64{0, 1, 2, 3, 10, 1000, 65536} {
+		cyclic, err := NewCyclic(size, 42)
+		assert.Nil(t, err)
+		elements := walk(cyclic)
+		assert.Len(t, elements, int(size))
+		seen := make(map[uint64]struct{})
+		for _, element := range elements {
+			assert.True(t, element < size)
+			seen[element] = struct{}{}
+		}
+		assert.Len(t, seen, int(size))
+	}
+}
+
+func TestCyclic_SameSeedSameOrder(t *testing.T) {
+	first, _ := NewCyclic(1000, 7)
+	second, _ := NewCyclic(1000, 7)
+	third, _ := NewCyclic(1000, 8)
+	firstOrder := walk(first)
+	assert.Equal(t, firstOrder, walk(second))
+	assert.NotEqual(t, firstOrder, walk(third))
+}
+
+func TestCyclic_PrimeStaysBelow2To32AtMaxSize(t *testing.T) {
+	assert.Equal(t, uint64(4294967291), nextPrime(MaxSize))
+	cyclic, err := NewCyclic(MaxSize, 42)
+	assert.Nil(t, err)
+	assert.True(t, cyclic.prime < 1 << 32)
+	_, err = NewCyclic(MaxSize + 1, 42)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,63 @@
+package pingscan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// A Checkpoint records how far a ping scan through an input file has progressed so that the scan
+// can be resumed if it is interrupted
+type Checkpoint struct {
+	InputPath		string		`json:"input_path"`
+	OutputPath		string		`json:"output_path"`
+	ErrorPath		string		`json:"error_path"`
+	Seed			int64		`json:"seed"`
+	Position		uint64		`json:"position"`
+
+	// Whether the scan is of candidates that are being generated as they are scanned
+	Pipelined		bool		`json:"pipelined,omitempty"`
+}
+
+// Read the checkpoint at filePath, returning nil if there isn't one
+func ReadCheckpoint(filePath string) (*Checkpoint, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func WriteCheckpoint(filePath string, checkpoint *Checkpoint) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash never leaves a partially-written checkpoint
+	tempPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(tempPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, filePath)
+}
+
+func RemoveCheckpoint(filePath string) error {
+	err := os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Whether or not this checkpoint is for a scan of inputPath in the order given by seed. A seed of
+// zero matches any order, as it means that no seed was configured.
+func (checkpoint *Checkpoint) Matches(inputPath string, seed int64) bool {
+	return checkpoint.InputPath == inputPath && (seed == 0 || seed == checkpoint.Seed)
+}
@@ -0,0 +1,108 @@
+package pingscan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/addressing"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/lavalamp-/ipv666/internal/simnet"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	config.InitConfig()
+	viper.Set("PingScanDrainTimeout", 0.05)
+	viper.Set("PingScanRetryCount", 0)
+	viper.Set("PingScanPrefixRate", 0)
+}
+
+func TestCheckpoint_RoundTrip(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "checkpoint.json")
+
+	checkpoint, err := ReadCheckpoint(filePath)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+
+	written := &Checkpoint{
+		InputPath:		"cands",
+		OutputPath:		"out",
+		ErrorPath:		"err",
+		Seed:			42,
+		Position:		1000,
+	}
+	assert.Nil(t, WriteCheckpoint(filePath, written))
+	checkpoint, err = ReadCheckpoint(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, written, checkpoint)
+	assert.True(t, checkpoint.Matches("cands", 0))
+	assert.True(t, checkpoint.Matches("cands", 42))
+	assert.False(t, checkpoint.Matches("cands", 43))
+	assert.False(t, checkpoint.Matches("other", 0))
+
+	assert.Nil(t, RemoveCheckpoint(filePath))
+	checkpoint, err = ReadCheckpoint(filePath)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+}
+
+func TestScan_ResumesFromStart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "resume")
+	defer os.RemoveAll(dir)
+	inputPath := filepath.Join(dir, "cands")
+	outputPath := filepath.Join(dir, "out")
+	errorPath := filepath.Join(dir, "err")
+
+	network := simnet.NewNetwork(1)
+	_, aliased, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(aliased)
+	addrs := addressing.GenerateRandomAddressesInNetwork(aliased, 200)
+	assert.Nil(t, addressing.WriteIPsToHexFile(inputPath, addrs))
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// Resuming halfway through should only probe the second half of the permutation
+	order := &Order{Seed: 7, Start: 100}
+	_, err := Scan(probe.PHASE_GENERATE, inputPath, outputPath, errorPath, "1G", order)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, network.GetTotalProbeCount())
+
+	// Resuming again should not write the same results twice
+	_, err = Scan(probe.PHASE_GENERATE, inputPath, outputPath, errorPath, "1G", order)
+	assert.Nil(t, err)
+	found, err := probe.ReadLiveAddrsFromRecordFile(outputPath)
+	assert.Nil(t, err)
+	assert.Len(t, found, 100)
+}
+
+func TestScan_ResumeDoesNotDuplicateErrors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "resume")
+	defer os.RemoveAll(dir)
+	inputPath := filepath.Join(dir, "cands")
+	outputPath := filepath.Join(dir, "out")
+	errorPath := filepath.Join(dir, "err")
+
+	network := simnet.NewNetwork(1)
+	_, unreachable, _ := net.ParseCIDR("2001:db8:1::/48")
+	router := net.ParseIP("2001:db8::ffff")
+	network.AddUnreachableNetwork(unreachable, &router, 3)
+	addrs := addressing.GenerateRandomAddressesInNetwork(unreachable, 200)
+	assert.Nil(t, addressing.WriteIPsToHexFile(inputPath, addrs))
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	order := &Order{Seed: 7, Start: 100}
+	_, err := Scan(probe.PHASE_GENERATE, inputPath, outputPath, errorPath, "1G", order)
+	assert.Nil(t, err)
+	_, err = Scan(probe.PHASE_GENERATE, inputPath, outputPath, errorPath, "1G", order)
+	assert.Nil(t, err)
+	records, err := probe.ReadRecordsFromFile(errorPath)
+	assert.Nil(t, err)
+	assert.Len(t, records, 100)
+}
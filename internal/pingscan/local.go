@@ -0,0 +1,49 @@
+package pingscan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"net"
+	"os"
+)
+
+// Scan the link that the scanner is attached to, writing a record of each reply and advertisement
+// to resultsFile. Returns every address that was found - both the addresses that replies came from
+// and the addresses that Neighbor Advertisements were sent for.
+func ScanLocal(scanner *probe.LocalScanner, generate probe.CandidateGenerator, resultsFile string) ([]*net.IP, error) {
+
+	results, err := scanner.Scan(generate)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(resultsFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var toReturn []*net.IP
+	seen := make(map[string]struct{})
+	for _, result := range results {
+		if err := probe.WriteRecord(file, result); err != nil {
+			return nil, err
+		}
+		for _, addr := range []*net.IP{result.Addr, result.Target} {
+			if _, ok := seen[addr.String()]; ok {
+				continue
+			}
+			seen[addr.String()] = struct{}{}
+			toReturn = append(toReturn, addr)
+		}
+	}
+
+	return toReturn, nil
+}
+
+func ScanLocalFromConfig(generate probe.CandidateGenerator, resultsFile string) ([]*net.IP, error) {
+	scanner, err := probe.NewLocalScannerFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	return ScanLocal(scanner, generate, resultsFile)
+}
@@ -2,201 +2,291 @@ package pingscan
 
 import (
 	"bufio"
-	"context"
 	"fmt"
-	"github.com/alecthomas/units"
+	"github.com/lavalamp-/ipv666/internal/config"
 	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/permutation"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/spf13/viper"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv6"
-	"golang.org/x/time/rate"
 	"net"
 	"os"
-	"sync/atomic"
 	"time"
 )
 
-func processReplies(conn *ipv6.PacketConn, outputFile string, done chan bool, hitCount *uint64) {
+// How the targets in an input file are ordered
+type Order struct {
+	Seed			int64
 
-	// Output file
-	file, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		logging.ErrorF(err)
-		return
-	}
-	defer file.Close()
+	// The position in the permutation to start scanning from
+	Start			uint64
 
-	// Receive loop
-	buff := make([]byte, 1500)
-	for {
-
-		// Read the next ping response
-		rlen, _, raddr, rerr := conn.ReadFrom(buff)
-		if rerr != nil {
-
-			// Read timeout
-			if nerr, ok := rerr.(net.Error); ok && nerr.Timeout() {
-				continue
-			}
-
-			// Temporary error
-			nerr, ok := rerr.(*net.OpError)
-			if ok && nerr.Temporary() {
-				continue
-			}
+	// If set, called periodically with the position that the scan can be resumed from
+	Checkpoint		func(position uint64)
+}
 
-			// Permanent error
-			break
-		}
+// Get the scan order, which is random unless a seed has been configured
+func GetOrderFromConfig() *Order {
+	seed := viper.GetInt64("PingScanSeed")
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Order{Seed: seed}
+}
 
-		// Parse the response
-		_, err := icmp.ParseMessage(58, buff[:rlen])
-		if err != nil {
-			logging.ErrorF(err)
+// Read the addresses in a file into a single contiguous slice of 16-byte addresses
+func loadTargets(inputFile string) ([]byte, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var toReturn []byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parsedAddr := net.ParseIP(scanner.Text())
+		if parsedAddr == nil {
 			continue
 		}
-		atomic.AddUint64(hitCount, 1)
-		fmt.Fprintf(file, "%s\n", raddr.String())
-		file.Sync()
+		toReturn = append(toReturn, parsedAddr.To16()...)
 	}
-	done <- true
+	return toReturn, scanner.Err()
 }
 
-func Scan(inputFile string, outputFile string, bandwidth string) (string, error) {
+// Ping scan the addresses in inputFile in a random order, writing records for the responding
+// addresses to outputFile and records for any ICMPv6 errors received to errorFile
+func Scan(phase probe.Phase, inputFile string, outputFile string, errorFile string, bandwidth string, order *Order) (string, error) {
 
 	logging.Infof("Performing ping scan on addresses defined in %s", inputFile)
 
-	// Instantiate ICMPv6 packet listener
-	listener, err := net.ListenPacket("ip6:58", "::")
+	// Load the targets and set up the order to scan them in
+	packed, err := loadTargets(inputFile)
 	if err != nil {
-		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
 		return "", err
 	}
-
-	// Instantiate IPv6 packet connection
-	conn := ipv6.NewPacketConn(listener)
-	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
-		logging.Warnf("Error thrown when setting control message: %s", err.Error())
+	targetCount := uint64(len(packed) / net.IPv6len)
+	cyclic, err := permutation.NewCyclic(targetCount, order.Seed)
+	if err != nil {
 		return "", err
 	}
+	logging.Debugf("Scanning %d addresses with seed %d from position %d.", targetCount, order.Seed, order.Start)
 
-	// Apply ICMP echo reply filter
-	var filter ipv6.ICMPFilter
-	filter.SetAll(true)
-	filter.Accept(ipv6.ICMPTypeEchoReply)
-	if err := conn.SetICMPFilter(&filter); err != nil {
-		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
-		return "", err
+	// Don't write the same results or errors twice when resuming a scan
+	var written *writtenRecords
+	if order.Start > 0 {
+		written, err = readWrittenRecords(outputFile, errorFile)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	// Ping configuration
-	// - 10-byte payload
-	// - 255-hop limit
-	echoData := []byte("0123456789")
-	wcm := &ipv6.ControlMessage{HopLimit: 255}
+	// Queue the addresses in the channel in permuted order. If the scan is halted then the engine
+	// stops reading targets, which also stops the checkpoint from moving past unsent targets.
+	targets := make(chan *net.IP)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(targets)
+
+		// The permutation position after each of the most recently queued targets. The engine may not
+		// have sent the most recent targets yet, so a scan can only safely be resumed from the position
+		// of the oldest one.
+		recent := make([]uint64, probe.GetMaxQueuedTargets(config.GetPingScanBatchSize(), config.GetPingScanSenderCount()) + 1)
+		queued := 0
+		lastCheckpoint := time.Now()
+
+		for {
+			index, ok := cyclic.Next()
+			if !ok {
+				return
+			}
+			position := cyclic.GetPosition()
+			if position <= order.Start {
+				continue
+			}
+			target := make(net.IP, net.IPv6len)
+			copy(target, packed[index * net.IPv6len:(index + 1) * net.IPv6len])
+			select {
+			case targets <- &target:
+			case <-stop:
+				return
+			}
 
-	// Use the zmap kp/s rates to estimate our bandwidth-constrained ping rate
-	maxBandwidthInt, err := units.ParseBase2Bytes(bandwidth)
-	targetRate := float64(maxBandwidthInt) / 1e6 * 1300
-	rateLimit := rate.Limit(targetRate)
-	rateLimiter := rate.NewLimiter(rateLimit, 10)
-	ctx := context.Background()
+			recent[queued % len(recent)] = position
+			queued++
+			if order.Checkpoint != nil && queued >= len(recent) && time.Since(lastCheckpoint) >= config.GetPingScanCheckpointDuration() {
+				order.Checkpoint(recent[queued % len(recent)])
+				lastCheckpoint = time.Now()
+			}
+		}
+	}()
 
-	// Read the addresses from disk and queue them in the channel
-	ips := make(chan net.IPAddr)
-	done := make(chan bool, 2)
-	go func() {
-		file, err := os.Open(inputFile)
+	return scanStream(phase, targets, outputFile, errorFile, bandwidth, written)
+}
+
+// The results and errors that an interrupted scan already wrote out
+type writtenRecords struct {
+	addrs			map[string]struct{}
+	errors			map[string]struct{}
+}
+
+// Errors are told apart by the target that drew them and who sent them why
+func getErrorKey(record *probe.Record) string {
+	return fmt.Sprintf("%s %s %d %d", record.Target, record.Addr, record.ICMPType, record.ICMPCode)
+}
+
+// Get the addresses that already have results written to outputFile and the errors already written
+// to errorFile
+func readWrittenRecords(outputFile string, errorFile string) (*writtenRecords, error) {
+	toReturn := &writtenRecords{
+		addrs:		make(map[string]struct{}),
+		errors:		make(map[string]struct{}),
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		addrs, err := probe.ReadLiveAddrsFromRecordFile(outputFile)
 		if err != nil {
-			logging.Warnf("Error thrown when opening IP input file: %s", err.Error())
-			return
+			return nil, err
 		}
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			ip := scanner.Text()
-			parsedAddr := net.ParseIP(ip)
-			dstAddr := net.IPAddr{IP: parsedAddr}
-			ips <- dstAddr
+		for _, addr := range addrs {
+			toReturn.addrs[addr.String()] = struct{}{}
 		}
-		done <- true
-	}()
-
-	// Kick off the receive processor
-	hitCount := uint64(0)
-	go processReplies(conn, outputFile, done, &hitCount)
+	}
+	if _, err := os.Stat(errorFile); !os.IsNotExist(err) {
+		records, err := probe.ReadRecordsFromFile(errorFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			toReturn.errors[getErrorKey(record)] = struct{}{}
+		}
+	}
+	return toReturn, nil
+}
 
-	// Ping each address
-	seq := uint16(0)
-	finished := false
-	count := uint64(0)
-	lastSecondCount := uint64(0)
-	lastStatus := time.Now().Unix()
-	for finished == false {
+// Whether or not a record for the result was already written by an interrupted scan
+func (written *writtenRecords) contains(result *probe.Result) bool {
+	if written == nil {
+		return false
+	}
+	if result.IsError() {
+		_, ok := written.errors[getErrorKey(probe.NewRecord(result))]
+		return ok
+	}
+	_, ok := written.addrs[result.Addr.String()]
+	return ok
+}
 
-		// Attempt to read from ips with a 1 second timeout
-		select {
+// Ping scan the addresses read from targets until the channel is closed, writing records for the
+// responding addresses to outputFile and records for any ICMPv6 errors received to errorFile. Targets
+// are scanned in the order that they are read, so the order's seed is unused and its position is
+// the number of targets read. If the scan cannot be started or is halted then targets is drained so
+// that the sender is not left blocked.
+func ScanStream(phase probe.Phase, targets <-chan *net.IP, outputFile string, errorFile string, bandwidth string, order *Order) (string, error) {
 
-		// Read
-		case ip := <-ips:
+	drain := func() {
+		for range targets {}
+	}
 
-			// Rate limit outgoing connections
-			rateLimiter.Wait(ctx)
+	// Don't write the same results or errors twice when resuming a scan
+	var written *writtenRecords
+	if order.Start > 0 {
+		var err error
+		written, err = readWrittenRecords(outputFile, errorFile)
+		if err != nil {
+			go drain()
+			return "", err
+		}
+	}
 
-			// Build the packet
-			ping := icmp.Message{
-				Type: ipv6.ICMPTypeEchoRequest,
-				Code: 0,
-				Body: &icmp.Echo{ID: int(seq), Seq: int(seq), Data: echoData},
-			}
-			req, err := ping.Marshal(nil)
-			if err != nil {
-				logging.Warnf("error encoding ICMP echo packet with destination %s (%s)", ip, err)
-				return "", err
-			}
-			seq += 1
+	// Hand the targets past the starting position to the engine. If the scan is halted then the engine
+	// stops reading targets, which also stops the checkpoint from moving past unsent targets.
+	queue := make(chan *net.IP)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(queue)
 
-			// Send the packet
-			_, werr := conn.WriteTo(req, wcm, &ip)
-			if werr != nil {
+		// As in Scan, the scan can only safely be resumed from the oldest of the recently queued targets
+		recent := make([]uint64, probe.GetMaxQueuedTargets(config.GetPingScanBatchSize(), config.GetPingScanSenderCount()) + 1)
+		queued := 0
+		lastCheckpoint := time.Now()
 
-				// Requeue the packet if it failed (i.e. due to network buffer backpressure)
-				go func() { ips <- ip }()
+		var position uint64
+		for target := range targets {
+			position++
+			if position <= order.Start {
 				continue
 			}
-
-			// Increment the counter
-			lastSecondCount += 1
-			count += 1
-			t := time.Now().Unix()
-			if t != lastStatus {
-				lastStatus = t
-				logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", count, atomic.LoadUint64(&hitCount), lastSecondCount)
-				lastSecondCount = 0
+			select {
+			case queue <- target:
+			case <-stop:
+				drain()
+				return
 			}
 
-		// Timeout
-		case <-time.After(5 * time.Second):
-			finished = true
-			break
+			recent[queued % len(recent)] = position
+			queued++
+			if order.Checkpoint != nil && queued >= len(recent) && time.Since(lastCheckpoint) >= config.GetPingScanCheckpointDuration() {
+				order.Checkpoint(recent[queued % len(recent)])
+				lastCheckpoint = time.Now()
+			}
 		}
+	}()
+
+	return scanStream(phase, queue, outputFile, errorFile, bandwidth, written)
+}
+
+func scanStream(phase probe.Phase, targets <-chan *net.IP, outputFile string, errorFile string, bandwidth string, written *writtenRecords) (string, error) {
+
+	drain := func() {
+		for range targets {}
 	}
 
-	// Wait for the file read goroutine to finish
-	<-done
+	// Output files
+	file, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		go drain()
+		return "", err
+	}
+	defer file.Close()
+	errFile, err := os.OpenFile(errorFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		go drain()
+		return "", err
+	}
+	defer errFile.Close()
 
-	// Close handle to stop the packet processor
-	conn.Close()
+	// Kick off the prober
+	prober, err := probe.NewEngine(phase, bandwidth, config.GetPingScanDrainDuration())
+	if err != nil {
+		go drain()
+		return "", err
+	}
+	results, err := prober.Probe(targets)
+	if err != nil {
+		go drain()
+		return "", err
+	}
 
-	// Close the listener
-	listener.Close()
+	// Write each of the responses and errors to disk
+	for result := range results {
+		if written.contains(result) {
+			continue
+		}
+		if result.IsError() {
+			probe.WriteRecord(errFile, result)
+			continue
+		}
+		probe.WriteRecord(file, result)
+		file.Sync()
+	}
 
-	// Wait for the receiver goroutine to finish
-	<-done
+	return "", prober.Err()
+}
 
-	return "", nil
+func ScanFromConfig(phase probe.Phase, inputFile string, outputFile string, errorFile string) (string, error) {
+	return Scan(phase, inputFile, outputFile, errorFile, viper.GetString("PingScanBandwidth"), GetOrderFromConfig())
 }
 
-func ScanFromConfig(inputFile string, outputFile string) (string, error) {
-	return Scan(inputFile, outputFile, viper.GetString("PingScanBandwidth"))
+func ScanStreamFromConfig(phase probe.Phase, targets <-chan *net.IP, outputFile string, errorFile string, order *Order) (string, error) {
+	return ScanStream(phase, targets, outputFile, errorFile, viper.GetString("PingScanBandwidth"), order)
 }
@@ -0,0 +1,42 @@
+package pingscan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"os"
+)
+
+// Rebuild the results of a ping scan from a pcap file of its traffic instead of sending probes,
+// writing records for the responding addresses to outputFile and records for any ICMPv6 errors
+// to errorFile in the same way that Scan does
+func Replay(phase probe.Phase, captureFile string, outputFile string, errorFile string) (string, error) {
+
+	logging.Infof("Replaying ping scan from packet capture at %s", captureFile)
+
+	results, err := probe.ReadResultsFromCapture(captureFile, phase)
+	if err != nil {
+		return "", err
+	}
+
+	// Output files
+	file, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	errFile, err := os.OpenFile(errorFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer errFile.Close()
+
+	for _, result := range results {
+		if result.IsError() {
+			probe.WriteRecord(errFile, result)
+		} else {
+			probe.WriteRecord(file, result)
+		}
+	}
+
+	return "", nil
+}
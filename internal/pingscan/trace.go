@@ -0,0 +1,83 @@
+package pingscan
+
+import (
+	"bufio"
+	"github.com/lavalamp-/ipv666/internal/addressing"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/permutation"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+)
+
+// Trace the route to each of the targets in a random order, writing the addresses of the routers
+// that answered along the way to routersFile and a record of the path to each target to pathsFile.
+// If the trace is halted then whatever was found before it stopped is still written out.
+func Trace(targets []*net.IP, routersFile string, pathsFile string, maxHops int, bandwidth string, order *Order) (*probe.PathSet, error) {
+
+	logging.Infof("Tracing the routes to %d addresses with hop limits of up to %d.", len(targets), maxHops)
+
+	cyclic, err := permutation.NewCyclic(uint64(len(targets)), order.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Queue the targets in permuted order until the tracer stops reading them
+	queue := make(chan *net.IP)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(queue)
+		for {
+			index, ok := cyclic.Next()
+			if !ok {
+				return
+			}
+			select {
+			case queue <- targets[index]:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	tracer, err := probe.NewTracer(maxHops, bandwidth, config.GetPingScanDrainDuration())
+	if err != nil {
+		return nil, err
+	}
+	results, err := tracer.Probe(queue)
+	if err != nil {
+		return nil, err
+	}
+	paths := probe.NewPathSet()
+	for result := range results {
+		paths.Add(result)
+	}
+
+	// Write out the routers and paths
+	if err := addressing.WriteIPsToHexFile(routersFile, paths.GetRouters()); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(pathsFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for _, path := range paths.GetPaths() {
+		if err := probe.WritePath(writer, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return paths, tracer.Err()
+}
+
+func TraceFromConfig(targets []*net.IP, routersFile string, pathsFile string) (*probe.PathSet, error) {
+	return Trace(targets, routersFile, pathsFile, viper.GetInt("TraceMaxHops"), viper.GetString("PingScanBandwidth"), GetOrderFromConfig())
+}
@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/ipv6"
+	"net"
+)
+
+// Look up the index of the named interface and parse the source address that probes should be
+// sent from. Either may be empty to leave the choice to the kernel, in which case a zero index or
+// nil address is returned. If both are given then the source address must be assigned to the
+// interface.
+func ResolveBinding(interfaceName string, sourceAddress string) (int, net.IP, error) {
+	var source net.IP
+	if sourceAddress != "" {
+		source = net.ParseIP(sourceAddress)
+		if source == nil || source.To4() != nil {
+			return 0, nil, errors.New(fmt.Sprintf("'%s' is not a valid IPv6 source address.", sourceAddress))
+		}
+	}
+	if interfaceName == "" {
+		return 0, source, nil
+	}
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return 0, nil, errors.New(fmt.Sprintf("Could not find network interface '%s': %s", interfaceName, err))
+	}
+	if source != nil && !hasAddress(iface, source) {
+		return 0, nil, errors.New(fmt.Sprintf("The source address %s is not assigned to interface '%s'.", source, interfaceName))
+	}
+	return iface.Index, source, nil
+}
+
+func hasAddress(iface *net.Interface, addr net.IP) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, ifaceAddr := range addrs {
+		if ipNet, ok := ifaceAddr.(*net.IPNet); ok && ipNet.IP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether or not a packet received with the given control message arrived on the interface and
+// for the address that the engine is bound to
+func (engine *Engine) isBoundTo(cm *ipv6.ControlMessage) bool {
+	if cm == nil {
+		return true
+	}
+	if engine.ifIndex != 0 && cm.IfIndex != engine.ifIndex {
+		return false
+	}
+	if engine.source != nil && cm.Dst != nil && !cm.Dst.Equal(engine.source) {
+		return false
+	}
+	return true
+}
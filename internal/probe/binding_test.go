@@ -0,0 +1,46 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/ipv6"
+	"net"
+	"testing"
+)
+
+func TestResolveBinding(t *testing.T) {
+	ifIndex, source, err := ResolveBinding("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ifIndex)
+	assert.Nil(t, source)
+
+	_, source, err = ResolveBinding("", "2001:db8::1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::1", source.String())
+
+	_, _, err = ResolveBinding("", "192.0.2.1")
+	assert.NotNil(t, err)
+	_, _, err = ResolveBinding("ipv666-missing0", "")
+	assert.NotNil(t, err)
+}
+
+func TestResolveBinding_SourceMustBeOnInterface(t *testing.T) {
+	loopback, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface named 'lo'")
+	}
+	ifIndex, source, err := ResolveBinding("lo", "::1")
+	assert.Nil(t, err)
+	assert.Equal(t, loopback.Index, ifIndex)
+	assert.True(t, source.Equal(net.IPv6loopback))
+	_, _, err = ResolveBinding("lo", "2001:db8::1")
+	assert.NotNil(t, err)
+}
+
+func TestEngine_IsBoundTo(t *testing.T) {
+	engine := &Engine{ifIndex: 2, source: net.ParseIP("2001:db8::1")}
+	assert.True(t, engine.isBoundTo(nil))
+	assert.True(t, engine.isBoundTo(&ipv6.ControlMessage{IfIndex: 2, Dst: net.ParseIP("2001:db8::1")}))
+	assert.False(t, engine.isBoundTo(&ipv6.ControlMessage{IfIndex: 3, Dst: net.ParseIP("2001:db8::1")}))
+	assert.False(t, engine.isBoundTo(&ipv6.ControlMessage{IfIndex: 2, Dst: net.ParseIP("2001:db8::2")}))
+	assert.True(t, (&Engine{}).isBoundTo(&ipv6.ControlMessage{IfIndex: 3, Dst: net.ParseIP("2001:db8::2")}))
+}
@@ -0,0 +1,291 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"golang.org/x/net/ipv6"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Classic pcap file header fields. Packets are written as raw IPv6 packets (LINKTYPE_RAW) as the
+// probe engine's sockets never see the link layer.
+const (
+	pcapMagic			= 0xa1b2c3d4
+	pcapVersionMajor	= 2
+	pcapVersionMinor	= 4
+	pcapSnapLength		= 65535
+	pcapLinkTypeRaw		= 101
+)
+
+// A CaptureWriter writes the packets that probe engines send and receive to a pcap file. It is safe
+// for use from multiple goroutines.
+type CaptureWriter struct {
+	lock			sync.Mutex
+	filePath		string
+	file			*os.File
+	writer			*bufio.Writer
+	count			int
+}
+
+var curCapture *CaptureWriter
+
+// Create a pcap file at filePath to write captured packets to
+func NewCaptureWriter(filePath string) (*CaptureWriter, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:6], pcapVersionMajor)
+	binary.LittleEndian.PutUint16(header[6:8], pcapVersionMinor)
+	binary.LittleEndian.PutUint32(header[16:20], pcapSnapLength)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeRaw)
+	if _, err := writer.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &CaptureWriter{
+		filePath:	filePath,
+		file:		file,
+		writer:		writer,
+	}, nil
+}
+
+// Write a packet captured at the given time
+func (capture *CaptureWriter) WritePacket(at time.Time, packet []byte) error {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+	captured := packet
+	if len(captured) > pcapSnapLength {
+		captured = captured[:pcapSnapLength]
+	}
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(at.Nanosecond() / 1000))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(captured)))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(packet)))
+	if _, err := capture.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err := capture.writer.Write(captured); err != nil {
+		return err
+	}
+	capture.count++
+	return nil
+}
+
+// Get the number of packets that have been written to the capture
+func (capture *CaptureWriter) GetPacketCount() int {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+	return capture.count
+}
+
+func (capture *CaptureWriter) GetFilePath() string {
+	return capture.filePath
+}
+
+func (capture *CaptureWriter) Close() error {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+	if err := capture.writer.Flush(); err != nil {
+		capture.file.Close()
+		return err
+	}
+	return capture.file.Close()
+}
+
+// Set the capture that all subsequently-created probe engines will record their packets to (nil to
+// stop capturing)
+func UseCapture(capture *CaptureWriter) {
+	curCapture = capture
+}
+
+// Rebuild the IPv6 packet that carried a message of the given upper-layer protocol. The kernel fills
+// in the checksum of the probes that are sent, so it is computed here for any message that doesn't
+// have one yet.
+func buildIPv6Packet(src net.IP, dst net.IP, hopLimit int, protocol int, message []byte) []byte {
+	packet := make([]byte, ipv6HeaderLength + len(message))
+	packet[0] = 6 << 4
+	binary.BigEndian.PutUint16(packet[4:6], uint16(len(message)))
+	packet[6] = byte(protocol)
+	packet[7] = byte(hopLimit)
+	copy(packet[8:24], src.To16())
+	copy(packet[24:40], dst.To16())
+	copy(packet[ipv6HeaderLength:], message)
+	offset := 2
+	if protocol != 58 {
+		offset = checksumOffsets[protocol]
+	}
+	if len(message) >= offset + 2 && message[offset] == 0 && message[offset + 1] == 0 {
+		checksum := getChecksum(packet[8:24], packet[24:40], protocol, packet[ipv6HeaderLength:])
+		binary.BigEndian.PutUint16(packet[ipv6HeaderLength + offset:], checksum)
+	}
+	return packet
+}
+
+// Compute the checksum of an upper-layer message (with a zero checksum field) over the IPv6
+// pseudo-header
+func getChecksum(src []byte, dst []byte, protocol int, message []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i + 1 < len(b); i += 2 {
+			sum += uint32(b[i]) << 8 | uint32(b[i + 1])
+		}
+		if len(b) % 2 == 1 {
+			sum += uint32(b[len(b) - 1]) << 8
+		}
+	}
+	add(src)
+	add(dst)
+	length := uint32(len(message))
+	sum += length >> 16 + length & 0xffff
+	sum += uint32(protocol)
+	add(message)
+	for sum > 0xffff {
+		sum = sum >> 16 + sum & 0xffff
+	}
+	return ^uint16(sum)
+}
+
+// A captureConn records every packet sent and received over a Conn to a capture. Packets sent over
+// a Conn that adds Destination Options headers to them are recorded with options as that header.
+type captureConn struct {
+	Conn
+	capture			*CaptureWriter
+	source			net.IP
+	protocol		int
+	options			[]byte
+}
+
+// Wrap conn, which carries the given upper-layer protocol, so that its packets are written to
+// capture. Packets that are sent without a source address are recorded as coming from source.
+func newCaptureConn(conn Conn, capture *CaptureWriter, source net.IP, protocol int) *captureConn {
+	return &captureConn{
+		Conn:		conn,
+		capture:	capture,
+		source:		source,
+		protocol:	protocol,
+	}
+}
+
+func (c *captureConn) ReadFrom(b []byte) (int, *ipv6.ControlMessage, net.Addr, error) {
+	n, cm, addr, err := c.Conn.ReadFrom(b)
+	if err != nil {
+		return n, cm, addr, err
+	}
+	ipAddr, ok := addr.(*net.IPAddr)
+	if !ok {
+		return n, cm, addr, err
+	}
+	dst, hopLimit := c.source, 0
+	if cm != nil {
+		if cm.Dst != nil {
+			dst = cm.Dst
+		}
+		hopLimit = cm.HopLimit
+	}
+	c.record(ipAddr.IP, dst, hopLimit, b[:n], nil)
+	return n, cm, addr, err
+}
+
+func (c *captureConn) WriteTo(b []byte, cm *ipv6.ControlMessage, dst net.Addr) (int, error) {
+	n, err := c.Conn.WriteTo(b, cm, dst)
+	if err == nil {
+		c.recordSent(b, cm, dst)
+	}
+	return n, err
+}
+
+func (c *captureConn) WriteBatch(ms []ipv6.Message, flags int) (int, error) {
+	batchConn, ok := c.Conn.(BatchConn)
+	if !ok {
+		for i, m := range ms {
+			var cm *ipv6.ControlMessage
+			if len(m.OOB) > 0 {
+				cm = parseSentControlMessage(m.OOB)
+			}
+			n, err := c.WriteTo(m.Buffers[0], cm, m.Addr)
+			if err != nil {
+				return i, err
+			}
+			ms[i].N = n
+		}
+		return len(ms), nil
+	}
+	n, err := batchConn.WriteBatch(ms, flags)
+	for _, m := range ms[:n] {
+		c.recordSent(m.Buffers[0], parseSentControlMessage(m.OOB), m.Addr)
+	}
+	return n, err
+}
+
+// Parse the control message that a packet was sent with. Parsing reads packet info as it is
+// received, where its address is the destination, but on a sent packet it is the source.
+func parseSentControlMessage(oob []byte) *ipv6.ControlMessage {
+	cm := &ipv6.ControlMessage{}
+	if err := cm.Parse(oob); err != nil {
+		return nil
+	}
+	cm.Src, cm.Dst = cm.Dst, nil
+	return cm
+}
+
+func (c *captureConn) recordSent(b []byte, cm *ipv6.ControlMessage, dst net.Addr) {
+	ipAddr, ok := dst.(*net.IPAddr)
+	if !ok {
+		return
+	}
+	src, hopLimit := c.source, 64
+	if cm != nil {
+		if cm.Src != nil {
+			src = cm.Src
+		}
+		if cm.HopLimit > 0 {
+			hopLimit = cm.HopLimit
+		}
+	}
+	c.record(src, ipAddr.IP, hopLimit, b, c.options)
+}
+
+func (c *captureConn) record(src net.IP, dst net.IP, hopLimit int, message []byte, options []byte) {
+	packet := buildIPv6Packet(src, dst, hopLimit, c.protocol, message)
+	if options != nil {
+		packet = insertDestinationOptions(packet, options)
+	}
+	if err := c.capture.WritePacket(time.Now(), packet); err != nil {
+		logging.Warnf("Error thrown when writing to packet capture: %s", err)
+	}
+}
+
+// Insert a Destination Options header between the IPv6 header of a packet and its upper-layer message
+func insertDestinationOptions(packet []byte, header []byte) []byte {
+	toReturn := make([]byte, len(packet) + len(header))
+	copy(toReturn, packet[:ipv6HeaderLength])
+	copy(toReturn[ipv6HeaderLength:], header)
+	copy(toReturn[ipv6HeaderLength + len(header):], packet[ipv6HeaderLength:])
+	toReturn[ipv6HeaderLength] = packet[6]
+	toReturn[6] = 60
+	binary.BigEndian.PutUint16(toReturn[4:6], uint16(len(toReturn) - ipv6HeaderLength))
+	return toReturn
+}
+
+// Get the address that the kernel would send probes to the Internet from, or the unspecified
+// address if there isn't a route. Connecting a UDP socket doesn't send any packets.
+func getDefaultSourceAddress() net.IP {
+	conn, err := net.Dial("udp6", "[2001:4860:4860::8888]:53")
+	if err != nil {
+		return net.IPv6unspecified
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP
+	}
+	return net.IPv6unspecified
+}
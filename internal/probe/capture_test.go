@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCaptureWriter_WritesPcap(t *testing.T) {
+	file, _ := ioutil.TempFile("", "capture")
+	file.Close()
+	defer os.Remove(file.Name())
+	capture, err := NewCaptureWriter(file.Name())
+	assert.Nil(t, err)
+	at := time.Unix(1500000000, 123456000)
+	assert.Nil(t, capture.WritePacket(at, []byte{1, 2, 3}))
+	assert.Nil(t, capture.Close())
+
+	content, _ := ioutil.ReadFile(file.Name())
+	assert.Len(t, content, 24 + 16 + 3)
+	assert.EqualValues(t, pcapMagic, binary.LittleEndian.Uint32(content[0:4]))
+	assert.EqualValues(t, pcapLinkTypeRaw, binary.LittleEndian.Uint32(content[20:24]))
+	assert.EqualValues(t, 1500000000, binary.LittleEndian.Uint32(content[24:28]))
+	assert.EqualValues(t, 123456, binary.LittleEndian.Uint32(content[28:32]))
+	assert.EqualValues(t, 3, binary.LittleEndian.Uint32(content[32:36]))
+	assert.Equal(t, []byte{1, 2, 3}, content[40:])
+}
+
+func TestBuildIPv6Packet_FillsInChecksum(t *testing.T) {
+	src := net.ParseIP("2001:db8::1")
+	dst := net.ParseIP("2001:db8:1::2")
+	msg := icmp.Message{
+		Type:	ipv6.ICMPTypeEchoRequest,
+		Body:	&icmp.Echo{ID: 1234, Seq: 5, Data: []byte("hello, world!")},
+	}
+	unsummed, _ := msg.Marshal(nil)
+	summed, _ := msg.Marshal(icmp.IPv6PseudoHeader(src, dst))
+
+	packet := buildIPv6Packet(src, dst, 255, 58, unsummed)
+	assert.Len(t, packet, 40 + len(summed))
+	assert.EqualValues(t, len(summed), binary.BigEndian.Uint16(packet[4:6]))
+	assert.EqualValues(t, 58, packet[6])
+	assert.EqualValues(t, 255, packet[7])
+	assert.Equal(t, src.To16(), net.IP(packet[8:24]))
+	assert.Equal(t, dst.To16(), net.IP(packet[24:40]))
+	assert.Equal(t, summed, packet[40:])
+
+	// Messages that already have a checksum are left alone
+	assert.Equal(t, summed, buildIPv6Packet(src, dst, 64, 58, summed)[40:])
+}
+
+func TestInsertDestinationOptions(t *testing.T) {
+	src := net.ParseIP("2001:db8::1")
+	dst := net.ParseIP("2001:db8:1::2")
+	message := []byte{128, 0, 0, 0, 0, 1, 0, 1}
+	packet := insertDestinationOptions(buildIPv6Packet(src, dst, 255, 58, message), paramProblemOptions)
+	assert.Len(t, packet, 40 + len(paramProblemOptions) + len(message))
+	assert.EqualValues(t, len(paramProblemOptions) + len(message), binary.BigEndian.Uint16(packet[4:6]))
+	assert.EqualValues(t, 60, packet[6])
+	assert.EqualValues(t, 58, packet[40])
+	assert.Equal(t, paramProblemOptions[1:], packet[41:48])
+	assert.Equal(t, dst.To16(), net.IP(packet[24:40]))
+	assert.EqualValues(t, 128, packet[48])
+}
@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"sync/atomic"
+	"time"
+)
+
+var probeRateLimitGauge = metrics.NewGaugeFloat64()
+var probeCongestionCount = metrics.NewCounter()
+
+func init() {
+	metrics.Register("probe.rate.limit.gauge", probeRateLimitGauge)
+	metrics.Register("probe.congestion.count", probeCongestionCount)
+}
+
+// The counts of replies received over the course of a single scan
+type replyCounts struct {
+	hits			uint64
+	errors			uint64
+	answered		uint64
+	rejected		uint64
+	duplicates		uint64
+	foreign			uint64
+}
+
+// A rateController adjusts the probe rate of a scan with additive increase and multiplicative
+// decrease. The rate is cut whenever the network stack refuses to send probes, the fraction of
+// probes that are answered drops, or the fraction of probes that draw ICMPv6 errors rises, and
+// otherwise climbs back up to the configured ceiling.
+type rateController struct {
+	ceiling			float64
+	floor			float64
+	increase		float64
+	decrease		float64
+	replyDrop		float64
+	errorRise		float64
+	minSamples		uint64
+	current			float64
+	replyBaseline	float64
+	errorBaseline	float64
+	hasBaseline		bool
+	lastSent		uint64
+	lastHits		uint64
+	lastErrors		uint64
+	lastFailures	uint64
+}
+
+func newRateController(ceiling float64) *rateController {
+	floor := viper.GetFloat64("PingScanAdaptiveMinRate")
+	if floor > ceiling {
+		floor = ceiling
+	}
+	return &rateController{
+		ceiling:		ceiling,
+		floor:			floor,
+		increase:		ceiling * viper.GetFloat64("PingScanAdaptiveIncrease"),
+		decrease:		viper.GetFloat64("PingScanAdaptiveDecrease"),
+		replyDrop:		viper.GetFloat64("PingScanAdaptiveReplyDrop"),
+		errorRise:		viper.GetFloat64("PingScanAdaptiveErrorRise"),
+		minSamples:		uint64(viper.GetInt("PingScanAdaptiveMinSamples")),
+		current:		ceiling,
+	}
+}
+
+// Update the rate from the running totals of probes sent, echo replies, ICMPv6 errors, and refused
+// sends for the scan, returning the new rate and whether or not congestion was seen
+func (controller *rateController) update(sent uint64, hits uint64, errors uint64, failures uint64) (float64, bool) {
+	sentDelta := sent - controller.lastSent
+	hitDelta := hits - controller.lastHits
+	errorDelta := errors - controller.lastErrors
+	failureDelta := failures - controller.lastFailures
+	controller.lastSent, controller.lastHits, controller.lastErrors, controller.lastFailures = sent, hits, errors, failures
+
+	congested := failureDelta > 0
+	if sentDelta >= controller.minSamples && sentDelta > 0 {
+		replyRatio := float64(hitDelta) / float64(sentDelta)
+		errorRatio := float64(errorDelta) / float64(sentDelta)
+		if controller.hasBaseline {
+			if replyRatio < controller.replyBaseline * (1 - controller.replyDrop) {
+				congested = true
+			}
+			if errorRatio > controller.errorBaseline + controller.errorRise {
+				congested = true
+			}
+		}
+
+		// Only learn what a healthy scan looks like from intervals without congestion
+		if !congested {
+			if controller.hasBaseline {
+				controller.replyBaseline = (controller.replyBaseline + replyRatio) / 2
+				controller.errorBaseline = (controller.errorBaseline + errorRatio) / 2
+			} else {
+				controller.replyBaseline, controller.errorBaseline = replyRatio, errorRatio
+				controller.hasBaseline = true
+			}
+		}
+	}
+
+	if congested {
+		controller.current *= controller.decrease
+		if controller.current < controller.floor {
+			controller.current = controller.floor
+		}
+	} else {
+		controller.current += controller.increase
+		if controller.current > controller.ceiling {
+			controller.current = controller.ceiling
+		}
+	}
+	return controller.current, congested
+}
+
+// Periodically adjust the limiter's rate to the conditions on the network until stop is closed
+func (engine *Engine) adaptRate(limiter *rate.Limiter, stats *sendStats, counts *replyCounts, stop <-chan struct{}) {
+	controller := newRateController(float64(engine.rateLimit))
+	ticker := time.NewTicker(engine.adaptInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		previous := float64(limiter.Limit())
+		current, congested := controller.update(
+			atomic.LoadUint64(&stats.sent),
+			atomic.LoadUint64(&counts.hits),
+			atomic.LoadUint64(&counts.errors),
+			atomic.LoadUint64(&stats.failed),
+		)
+		limiter.SetLimit(rate.Limit(current))
+		probeRateLimitGauge.Update(current)
+		if congested {
+			probeCongestionCount.Inc(1)
+			logging.Infof("Seeing signs of congestion, reducing probe rate from %.0f to %.0f packets/second.", previous, current)
+		} else if current != previous {
+			logging.Debugf("Increasing probe rate from %.0f to %.0f packets/second.", previous, current)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestRateController() *rateController {
+	return &rateController{
+		ceiling:		1000,
+		floor:			100,
+		increase:		50,
+		decrease:		0.5,
+		replyDrop:		0.5,
+		errorRise:		0.1,
+		minSamples:		100,
+		current:		1000,
+	}
+}
+
+func TestRateController_BacksOffOnRefusedSends(t *testing.T) {
+	controller := newTestRateController()
+	current, congested := controller.update(1000, 100, 0, 1)
+	assert.True(t, congested)
+	assert.Equal(t, float64(500), current)
+	current, _ = controller.update(2000, 200, 0, 1)
+	assert.Equal(t, float64(550), current)
+}
+
+func TestRateController_BacksOffOnFewerReplies(t *testing.T) {
+	controller := newTestRateController()
+	_, congested := controller.update(1000, 100, 0, 0)
+	assert.False(t, congested)
+	_, congested = controller.update(2000, 200, 0, 0)
+	assert.False(t, congested)
+	current, congested := controller.update(3000, 220, 0, 0)
+	assert.True(t, congested)
+	assert.Equal(t, float64(500), current)
+}
+
+func TestRateController_BacksOffOnMoreErrors(t *testing.T) {
+	controller := newTestRateController()
+	_, congested := controller.update(1000, 100, 50, 0)
+	assert.False(t, congested)
+	_, congested = controller.update(2000, 200, 300, 0)
+	assert.True(t, congested)
+}
+
+func TestRateController_StaysWithinBounds(t *testing.T) {
+	controller := newTestRateController()
+	var current float64
+	for i := uint64(1); i <= 10; i++ {
+		current, _ = controller.update(0, 0, 0, i)
+	}
+	assert.Equal(t, float64(100), current)
+	for i := 0; i < 100; i++ {
+		current, _ = controller.update(0, 0, 0, 10)
+	}
+	assert.Equal(t, float64(1000), current)
+}
@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// The number of bytes of the MAC that are carried in the echo payload (the first two bytes of the
+// MAC are carried in the echo identifier)
+const cookieTagLength = 8
+
+// The length of the echo payload - an 8-byte send timestamp followed by the MAC tag
+const cookiePayloadLength = 8 + cookieTagLength
+
+// A cookieJar signs outgoing probes with a secret that is unique to a single scan so that the
+// replies to those probes can be told apart from stray, spoofed, or stale replies
+type cookieJar struct {
+	key			[]byte
+}
+
+func newCookieJar() (*cookieJar, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error thrown when generating probe cookie key: %s", err))
+	}
+	return &cookieJar{key: key}, nil
+}
+
+func (jar *cookieJar) mac(addr net.IP, sentAt []byte) []byte {
+	h := hmac.New(sha256.New, jar.key)
+	h.Write(addr.To16())
+	h.Write(sentAt)
+	return h.Sum(nil)
+}
+
+// Get the echo identifier and payload for a probe sent to addr at the given time
+func (jar *cookieJar) sign(addr net.IP, sentAt time.Time) (int, []byte) {
+	payload := make([]byte, cookiePayloadLength)
+	binary.BigEndian.PutUint64(payload[:8], uint64(sentAt.UnixNano()))
+	sum := jar.mac(addr, payload[:8])
+	copy(payload[8:], sum[2:2 + cookieTagLength])
+	return int(binary.BigEndian.Uint16(sum[:2])), payload
+}
+
+// Check whether the echo identifier and payload of a reply from addr match a probe that was
+// signed by this jar, returning the time that the probe was sent at if so
+func (jar *cookieJar) verify(addr net.IP, id int, payload []byte) (time.Time, bool) {
+	if len(payload) != cookiePayloadLength {
+		return time.Time{}, false
+	}
+	sum := jar.mac(addr, payload[:8])
+	if id != int(binary.BigEndian.Uint16(sum[:2])) || !hmac.Equal(payload[8:], sum[2:2 + cookieTagLength]) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(payload[:8]))), true
+}
+
+// Check whether a response answers a probe that was signed by this jar, recording the time that
+// the probe was sent at on the result if so
+func (jar *cookieJar) verifyResult(result *signedResult, receivedAt time.Time) bool {
+	var sentAt time.Time
+	var ok bool
+	if result.protocol == 58 {
+		sentAt, ok = jar.verify(*result.Target, result.id, result.payload)
+	} else {
+		sentAt, ok = jar.verifyPort(*result.Target, result.Port, result.srcPort, result.cookie, result.cookieMask, receivedAt)
+	}
+	if ok {
+		result.SentAt = sentAt
+	}
+	return ok
+}
+
+// TCP and UDP probes are sent from a source port in [probePortBase, probePortBase + probePortRange)
+// that encodes the millisecond that they were sent in, so that round trip times can be worked out
+// without keeping any state
+const probePortBase = 32768
+const probePortRange = 32768
+
+func (jar *cookieJar) portCookie(addr net.IP, dstPort int, srcPort int) uint32 {
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], uint16(dstPort))
+	binary.BigEndian.PutUint16(ports[2:4], uint16(srcPort))
+	return binary.BigEndian.Uint32(jar.mac(addr, ports)[:4])
+}
+
+// Get the source port and cookie for a TCP or UDP probe sent to port on addr at the given time
+func (jar *cookieJar) signPort(addr net.IP, port int, sentAt time.Time) (int, uint32) {
+	srcPort := probePortBase + int(sentAt.UnixNano() / int64(time.Millisecond) % probePortRange)
+	return srcPort, jar.portCookie(addr, port, srcPort)
+}
+
+// Check whether a reply sent from port on addr to srcPort carries the cookie (or the bits of it
+// within mask) of a probe that was signed by this jar, returning the time (to the millisecond) that
+// the probe was sent at if so
+func (jar *cookieJar) verifyPort(addr net.IP, port int, srcPort int, cookie uint32, mask uint32, receivedAt time.Time) (time.Time, bool) {
+	if srcPort < probePortBase || srcPort >= probePortBase + probePortRange || cookie & mask != jar.portCookie(addr, port, srcPort) & mask {
+		return time.Time{}, false
+	}
+	receivedMs := receivedAt.UnixNano() / int64(time.Millisecond)
+	elapsed := (receivedMs % probePortRange - int64(srcPort - probePortBase) + probePortRange) % probePortRange
+	return time.Unix(0, (receivedMs - elapsed) * int64(time.Millisecond)), true
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCookieJar_VerifiesSignedProbe(t *testing.T) {
+	jar, _ := newCookieJar()
+	addr := net.ParseIP("2001:db8::1")
+	sentAt := time.Now()
+	id, payload := jar.sign(addr, sentAt)
+	verifiedAt, ok := jar.verify(addr, id, payload)
+	assert.True(t, ok)
+	assert.Equal(t, sentAt.UnixNano(), verifiedAt.UnixNano())
+}
+
+func TestCookieJar_RejectsOtherAddress(t *testing.T) {
+	jar, _ := newCookieJar()
+	id, payload := jar.sign(net.ParseIP("2001:db8::1"), time.Now())
+	_, ok := jar.verify(net.ParseIP("2001:db8::2"), id, payload)
+	assert.False(t, ok)
+}
+
+func TestCookieJar_RejectsOtherScan(t *testing.T) {
+	first, _ := newCookieJar()
+	second, _ := newCookieJar()
+	addr := net.ParseIP("2001:db8::1")
+	id, payload := first.sign(addr, time.Now())
+	_, ok := second.verify(addr, id, payload)
+	assert.False(t, ok)
+}
+
+func TestCookieJar_RejectsStaticPayload(t *testing.T) {
+	jar, _ := newCookieJar()
+	_, ok := jar.verify(net.ParseIP("2001:db8::1"), 0, []byte("0123456789"))
+	assert.False(t, ok)
+}
+
+func TestCookieJar_VerifiesSignedPortProbe(t *testing.T) {
+	jar, _ := newCookieJar()
+	addr := net.ParseIP("2001:db8::1")
+	sentAt := time.Now()
+	srcPort, cookie := jar.signPort(addr, 443, sentAt)
+	verifiedAt, ok := jar.verifyPort(addr, 443, srcPort, cookie, 0xffffffff, sentAt.Add(250 * time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, sentAt.Truncate(time.Millisecond).UnixNano(), verifiedAt.UnixNano())
+}
+
+func TestCookieJar_RejectsPortReplyFromOtherPort(t *testing.T) {
+	jar, _ := newCookieJar()
+	addr := net.ParseIP("2001:db8::1")
+	srcPort, cookie := jar.signPort(addr, 443, time.Now())
+	_, ok := jar.verifyPort(addr, 80, srcPort, cookie, 0xffffffff, time.Now())
+	assert.False(t, ok)
+	_, ok = jar.verifyPort(addr, 443, srcPort, cookie + 1, 0xffffffff, time.Now())
+	assert.False(t, ok)
+}
+
+func TestCookieJar_VerifiesMaskedPortCookie(t *testing.T) {
+	jar, _ := newCookieJar()
+	addr := net.ParseIP("2001:db8::1")
+	srcPort, cookie := jar.signPort(addr, 53, time.Now())
+	_, ok := jar.verifyPort(addr, 53, srcPort, cookie & 0xffff, 0xffff, time.Now())
+	assert.True(t, ok)
+	_, ok = jar.verifyPort(addr, 53, srcPort, (cookie + 1) & 0xffff, 0xffff, time.Now())
+	assert.False(t, ok)
+}
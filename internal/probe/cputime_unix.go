@@ -0,0 +1,17 @@
+// +build !windows
+
+package probe
+
+import (
+	"syscall"
+	"time"
+)
+
+// Get the total user and system CPU time used by this process so far
+func getCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,10 @@
+// +build windows
+
+package probe
+
+import "time"
+
+// CPU time is not tracked on Windows
+func getCPUTime() (time.Duration, bool) {
+	return 0, false
+}
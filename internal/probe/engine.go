@@ -0,0 +1,948 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/blacklist"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/time/rate"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var probeRejectedCount = metrics.NewCounter()
+var probeDuplicateCount = metrics.NewCounter()
+var probeForeignCount = metrics.NewCounter()
+var probeRetryCount = metrics.NewCounter()
+var probeLossGauge = metrics.NewGaugeFloat64()
+var probeSentCount = metrics.NewCounter()
+var probeAnsweredCount = metrics.NewCounter()
+var probeInFlightGauge = metrics.NewGauge()
+var probeSendFailedCount = metrics.NewCounter()
+var probeSendAbandonedCount = metrics.NewCounter()
+var probeSentMeter = metrics.NewMeter()
+var probeCPUGauge = metrics.NewGauge()
+var probeSentBytesCount = metrics.NewCounter()
+var probeSentRateGauge = metrics.NewGaugeFloat64()
+
+// The number of targets that answered with each type of reply, so that the response rates of
+// different kinds of probes can be compared
+var probeAnsweredByTypeCounts = make(map[ResultType]metrics.Counter)
+
+func init() {
+	metrics.Register("probe.replies.rejected.count", probeRejectedCount)
+	metrics.Register("probe.replies.duplicate.count", probeDuplicateCount)
+	metrics.Register("probe.replies.foreign.count", probeForeignCount)
+	metrics.Register("probe.retries.count", probeRetryCount)
+	metrics.Register("probe.loss.gauge", probeLossGauge)
+	metrics.Register("probe.sent.count", probeSentCount)
+	metrics.Register("probe.answered.count", probeAnsweredCount)
+	metrics.Register("probe.inflight.gauge", probeInFlightGauge)
+	metrics.Register("probe.sends.failed.count", probeSendFailedCount)
+	metrics.Register("probe.sends.abandoned.count", probeSendAbandonedCount)
+	metrics.Register("probe.sent.meter", probeSentMeter)
+	metrics.Register("probe.cpu.per_probe.gauge", probeCPUGauge)
+	metrics.Register("probe.sent.bytes.count", probeSentBytesCount)
+	metrics.Register("probe.sent.rate.gauge", probeSentRateGauge)
+	for resultType, name := range resultTypeNames {
+		probeAnsweredByTypeCounts[resultType] = metrics.NewCounter()
+		metrics.Register(fmt.Sprintf("probe.answered.%s.count", name), probeAnsweredByTypeCounts[resultType])
+	}
+}
+
+// Engine is the Prober implementation. It sends ICMPv6 echo requests and/or TCP SYNs to its targets
+// over a Transport (raw IPv6 sockets unless configured otherwise) and reports the replies that it
+// receives.
+type Engine struct {
+	phase			Phase
+	transport		Transport
+	rateLimit		rate.Limit
+	wireSize		int
+	drainTimeout	time.Duration
+	retryCount		int
+	retryTimeout	time.Duration
+	prefixLength	int
+	prefixRate		float64
+	sendRetryCount	int
+	sendBackoff		time.Duration
+	batchSize		int
+	senderCount		int
+	adaptive		bool
+	adaptInterval	time.Duration
+	haltInterval	time.Duration
+	haltPause		time.Duration
+	exclusions		*blacklist.NetworkBlacklist
+	exclusionLog	string
+	ifIndex			int
+	source			net.IP
+	capture			*CaptureWriter
+	hopLimits		[]int
+	tracing			bool
+	icmp			bool
+	paramProblem	bool
+	tcpPorts		[]int
+	udpPorts		[]int
+	err				error
+}
+
+// Create an engine that sends at most bandwidth worth of probes (or PingScanRate probes per second
+// if set) and that keeps listening for drainTimeout after its targets channel is closed and the
+// last probe is sent
+func NewEngine(phase Phase, bandwidth string, drainTimeout time.Duration) (*Engine, error) {
+
+	// The kinds of probes to send to each target
+	probeTypes, err := ParseProbeType(viper.GetString("PingScanProbe"))
+	if err != nil {
+		return nil, err
+	}
+	var tcpPorts, udpPorts []int
+	if probeTypes.TCP {
+		tcpPorts, err = ParseTCPPorts(viper.GetString("PingScanTCPPorts"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if probeTypes.UDP {
+		udpPorts, err = ParseUDPPorts(viper.GetString("PingScanUDPPorts"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Work out the probe rate from the size of the largest probes on the wire
+	template, err := newEchoTemplate()
+	if err != nil {
+		return nil, err
+	}
+	probeLength := len(template)
+	if probeTypes.ParamProblem {
+		probeLength += len(paramProblemOptions)
+	}
+	if probeTypes.TCP && tcpHeaderLength > probeLength {
+		probeLength = tcpHeaderLength
+	}
+	if udpLength := getUDPProbeLength(udpPorts); udpLength > probeLength {
+		probeLength = udpLength
+	}
+	wireSize := getWireSize(probeLength)
+	targetRate, err := getProbeRate(bandwidth, viper.GetFloat64("PingScanRate"), wireSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// The interface and address to send probes from
+	ifIndex, source, err := ResolveBinding(viper.GetString("PingScanInterface"), viper.GetString("PingScanSourceAddress"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Networks that must never be probed
+	exclusions, err := ReadExclusionsFromFile(config.GetExclusionFilePath())
+	if err != nil {
+		return nil, err
+	}
+	if exclusions.GetCount() > 0 {
+		logging.Debugf("Loaded %d excluded networks from '%s'.", exclusions.GetCount(), config.GetExclusionFilePath())
+	}
+
+	return &Engine{
+		phase:			phase,
+		transport:		curTransport,
+		rateLimit:		rate.Limit(targetRate),
+		wireSize:		wireSize,
+		drainTimeout:	drainTimeout,
+		retryCount:		viper.GetInt("PingScanRetryCount"),
+		retryTimeout:	config.GetPingScanRetryDuration(),
+		prefixLength:	viper.GetInt("PingScanPrefixLength"),
+		prefixRate:		viper.GetFloat64("PingScanPrefixRate"),
+		sendRetryCount:	viper.GetInt("PingScanSendRetryCount"),
+		sendBackoff:	config.GetPingScanSendBackoffDuration(),
+		batchSize:		config.GetPingScanBatchSize(),
+		senderCount:	config.GetPingScanSenderCount(),
+		adaptive:		viper.GetBool("PingScanAdaptiveRate"),
+		adaptInterval:	config.GetPingScanAdaptiveDuration(),
+		haltInterval:	config.GetPingScanHaltDuration(),
+		haltPause:		config.GetPingScanHaltPauseDuration(),
+		exclusions:		exclusions,
+		exclusionLog:	config.GetExclusionLogFilePath(),
+		ifIndex:		ifIndex,
+		source:			source,
+		capture:		curCapture,
+		hopLimits:		[]int{defaultHopLimit},
+		icmp:			probeTypes.ICMP,
+		paramProblem:	probeTypes.ParamProblem,
+		tcpPorts:		tcpPorts,
+		udpPorts:		udpPorts,
+	}, nil
+}
+
+// Get the number of probes that are sent to each target
+func (engine *Engine) getProbesPerTarget() int {
+	toReturn := len(engine.tcpPorts) + len(engine.udpPorts)
+	if engine.icmp {
+		toReturn += len(engine.hopLimits)
+	}
+	if engine.paramProblem {
+		toReturn++
+	}
+	return toReturn
+}
+
+// Get the reason that the most recent scan was stopped early, if it was. Only valid once the
+// scan's results channel has been closed.
+func (engine *Engine) Err() error {
+	return engine.err
+}
+
+func (engine *Engine) Probe(targets <-chan *net.IP) (<-chan *Result, error) {
+
+	// Generate the secret that this scan's probes are signed with
+	jar, err := newCookieJar()
+	if err != nil {
+		logging.Warnf("Error thrown when creating probe cookies: %s", err.Error())
+		return nil, err
+	}
+
+	// Instantiate ICMPv6 packet connection
+	conn, err := engine.listen(58, nil)
+	if err != nil {
+		return nil, err
+	}
+	conns := &probeConns{icmp: conn}
+
+	// Apply ICMP filter for echo replies and the errors that can be linked back to a probe
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeEchoReply)
+	filter.Accept(ipv6.ICMPTypeDestinationUnreachable)
+	filter.Accept(ipv6.ICMPTypePacketTooBig)
+	filter.Accept(ipv6.ICMPTypeTimeExceeded)
+	filter.Accept(ipv6.ICMPTypeParameterProblem)
+	if err := conn.SetICMPFilter(&filter); err != nil {
+		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+		conn.Close()
+		return nil, err
+	}
+
+	// Instantiate the ICMPv6 packet connection that Parameter Problem probes are sent over. The
+	// errors that they draw arrive over the main ICMPv6 connection, so nothing is read from it.
+	if engine.paramProblem {
+		if conns.options, err = engine.listen(58, paramProblemOptions); err != nil {
+			conns.close()
+			return nil, err
+		}
+		var blockAll ipv6.ICMPFilter
+		blockAll.SetAll(true)
+		if err := conns.options.SetICMPFilter(&blockAll); err != nil {
+			logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+			conns.close()
+			return nil, err
+		}
+	}
+
+	// Instantiate TCP packet connection (SYN-ACKs and RSTs are delivered to raw TCP sockets as well
+	// as to the kernel's own stack)
+	if len(engine.tcpPorts) > 0 {
+		if conns.tcp, err = engine.listen(6, nil); err != nil {
+			conns.close()
+			return nil, err
+		}
+	}
+
+	// Instantiate UDP packet connection (service replies are delivered to raw UDP sockets as well,
+	// while Port Unreachable errors arrive over the ICMPv6 connection)
+	if len(engine.udpPorts) > 0 {
+		if conns.udp, err = engine.listen(17, nil); err != nil {
+			conns.close()
+			return nil, err
+		}
+	}
+
+	// Kick off the receive processors and the sender
+	results := make(chan *Result, 1024)
+	done := make(chan bool, 3)
+	counts := &replyCounts{}
+	pending := newPendingSet(engine.retryCount, engine.retryTimeout)
+	monitor := newSafetyMonitor(engine.prefixLength)
+	recv := &receiver{
+		jar:		jar,
+		pending:	pending,
+		monitor:	monitor,
+		reported:	newReportedSet(),
+		results:	results,
+		counts:		counts,
+	}
+	engine.err = nil
+	receivers := 1
+	go engine.processReplies(conns.icmp, recv, done)
+	if conns.tcp != nil {
+		receivers++
+		go engine.processTCPReplies(conns.tcp, recv, done)
+	}
+	if conns.udp != nil {
+		receivers++
+		go engine.processUDPReplies(conns.udp, recv, done)
+	}
+	go func() {
+		sentCount, haltErr := engine.sendProbes(conns, jar, pending, monitor, targets, counts)
+
+		// Give replies to the last probes a chance to arrive before closing the handles
+		// Abandoned probes can leave fewer sent than were retried or answered, so these are clamped at zero
+		targetCount := int64(sentCount) / int64(engine.getProbesPerTarget()) - int64(pending.getRetryCount())
+		if targetCount < 0 {
+			targetCount = 0
+		}
+		inFlight := targetCount - int64(atomic.LoadUint64(&counts.answered))
+		if inFlight < 0 {
+			inFlight = 0
+		}
+		probeInFlightGauge.Update(inFlight)
+		logging.Infof("Finished sending %d probes (%d in flight). Waiting %s for late replies.", sentCount, inFlight, engine.drainTimeout)
+		time.Sleep(engine.drainTimeout)
+
+		// Close handles to stop the packet processors
+		conns.close()
+
+		// Wait for the receiver goroutines to finish
+		for i := 0; i < receivers; i++ {
+			<-done
+		}
+
+		rejected, duplicates := atomic.LoadUint64(&counts.rejected), atomic.LoadUint64(&counts.duplicates)
+		if rejected > 0 || duplicates > 0 {
+			logging.Infof("Discarded %d replies with invalid cookies and %d duplicate replies", rejected, duplicates)
+		}
+		if foreign := atomic.LoadUint64(&counts.foreign); foreign > 0 {
+			logging.Infof("Discarded %d packets received on other interfaces or for other addresses", foreign)
+		}
+
+		answered := atomic.LoadUint64(&counts.answered)
+		probeSentCount.Inc(int64(sentCount))
+		probeAnsweredCount.Inc(int64(answered))
+		logging.Infof("Scan complete. Sent %d probes to %d targets, %d of which answered.", sentCount, targetCount, answered)
+		if summary := recv.reported.getTypeSummary(); summary != "" {
+			logging.Infof("Targets answering by reply type: %s.", summary)
+		}
+		probeRetryCount.Inc(int64(pending.getRetryCount()))
+		if loss, ok := pending.estimateLoss(); ok {
+			probeLossGauge.Update(loss)
+			logging.Infof("Sent %d retries. Estimated packet loss for this scan is %.2f%%.", pending.getRetryCount(), loss * 100)
+		}
+
+		// Nothing may run after results is closed, as callers treat that as the end of the scan
+		engine.err = haltErr
+		close(results)
+	}()
+
+	return results, nil
+}
+
+// The connections that a scan's probes are sent and answered over. The connections other than the
+// main ICMPv6 one are only opened when their kind of probe is being sent.
+type probeConns struct {
+	icmp			Conn
+	options			Conn
+	tcp				Conn
+	udp				Conn
+}
+
+func (conns *probeConns) close() {
+	for _, conn := range []Conn{conns.icmp, conns.options, conns.tcp, conns.udp} {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+// Open a connection for the given upper-layer protocol that reports where the packets it receives
+// were addressed to, recording what goes over the wire if a capture is being taken. If options is
+// set then it is added to every packet sent as a Destination Options header.
+func (engine *Engine) listen(protocol int, options []byte) (Conn, error) {
+	conn, err := engine.transport.Listen(protocol)
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
+		return nil, err
+	}
+	if options != nil {
+		optionsConn, ok := conn.(OptionsConn)
+		if !ok {
+			conn.Close()
+			return nil, errors.New("The transport doesn't support adding Destination Options headers to probes.")
+		}
+		if err := optionsConn.SetDestinationOptions(options); err != nil {
+			logging.Warnf("Error thrown when setting destination options: %s", err.Error())
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		logging.Warnf("Error thrown when setting control message: %s", err.Error())
+		conn.Close()
+		return nil, err
+	}
+	if engine.capture != nil {
+		source := engine.source
+		if source == nil {
+			source = getDefaultSourceAddress()
+		}
+		captured := newCaptureConn(conn, engine.capture, source, protocol)
+		captured.options = options
+		conn = captured
+	}
+	return conn, nil
+}
+
+// Send probes to every target read from targets until the channel is closed and every target has
+// been sent its probes, returning the number of probes sent. If the safety monitor stops the scan
+// early then no more targets are read and the reason is returned as a HaltError.
+func (engine *Engine) sendProbes(conns *probeConns, jar *cookieJar, pending *pendingSet, monitor *safetyMonitor, targets <-chan *net.IP, counts *replyCounts) (uint64, error) {
+
+	// Ping configuration
+	// - 16-byte payload (send time and cookie)
+	// - 255-hop limit (or one probe per hop limit when tracing)
+	var wcms []*ipv6.ControlMessage
+	if engine.icmp {
+		for _, hopLimit := range engine.hopLimits {
+			wcms = append(wcms, &ipv6.ControlMessage{HopLimit: hopLimit, Src: engine.source, IfIndex: engine.ifIndex})
+		}
+	}
+	perTarget := engine.getProbesPerTarget()
+	template, err := newEchoTemplate()
+	if err != nil {
+		logging.Warnf("Error thrown when encoding ICMP echo packet template: %s", err)
+		for range targets {}
+		return 0, nil
+	}
+
+	// Kick off the senders that sign, marshal, and send batches of probes
+	batches := make(chan *probeBatch, engine.senderCount)
+	stats := &sendStats{}
+	var wg sync.WaitGroup
+	for i := 0; i < engine.senderCount; i++ {
+		wg.Add(1)
+		go engine.runSender(conns, jar, pending, template, wcms, batches, stats, monitor, &wg)
+	}
+	startCPU, _ := getCPUTime()
+	start := time.Now()
+
+	burst := 10
+	if engine.batchSize * perTarget > burst {
+		burst = engine.batchSize * perTarget
+	}
+	rateLimiter := rate.NewLimiter(engine.rateLimit, burst)
+	ctx := context.Background()
+
+	// Back off when the network shows signs of congestion
+	if engine.adaptive {
+		stopAdapting := make(chan struct{})
+		defer close(stopAdapting)
+		go engine.adaptRate(rateLimiter, stats, counts, stopAdapting)
+	}
+
+	// Stop or pause when the network objects to the scan
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go engine.watchSafety(monitor, stats, stopWatching)
+	tripped := monitor.getTripped()
+	paused := false
+	var haltErr error
+
+	// Targets in excluded networks are dropped right before they would be sent
+	exclusions := newExclusionLog(engine.exclusionLog)
+	defer exclusions.close()
+
+	// Check for targets to retry several times per timeout period
+	var checkC <-chan time.Time
+	if engine.retryCount > 0 {
+		checkTicker := time.NewTicker(engine.retryTimeout / 4 + time.Millisecond)
+		defer checkTicker.Stop()
+		checkC = checkTicker.C
+	}
+
+	// Ping each address, interleaving targets across prefixes (the per-prefix rate is in packets)
+	queue := newPoliteQueue(engine.prefixLength, engine.prefixRate / float64(perTarget))
+	batch := &probeBatch{}
+	seq := uint16(0)
+	lastSecondCount := uint64(0)
+	lastStatus := time.Now().Unix()
+
+	// Queue up unanswered targets for retry
+	check := func(now time.Time) {
+		for _, retry := range pending.due(now) {
+			queue.push(retry)
+		}
+	}
+
+	// Hand the current batch off to the senders, rate limiting outgoing packets (including retries)
+	flush := func() {
+		if len(batch.targets) == 0 {
+			return
+		}
+		rateLimiter.WaitN(ctx, len(batch.targets) * perTarget)
+		batch.seq = seq
+		seq += uint16(len(batch.targets))
+		atomic.AddInt64(&stats.outstanding, 1)
+		batches <- batch
+		batch = &probeBatch{targets: make([]*net.IP, 0, engine.batchSize)}
+
+		sent := atomic.LoadUint64(&stats.sent)
+		t := time.Now().Unix()
+		if t != lastStatus {
+			lastStatus = t
+			logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", sent, atomic.LoadUint64(&counts.hits), sent - lastSecondCount)
+			lastSecondCount = sent
+		}
+	}
+
+scan:
+	for {
+
+		select {
+		case <-tripped:
+			if haltErr = engine.handleHalt(monitor, stats, &paused); haltErr != nil {
+				break scan
+			}
+			tripped = monitor.getTripped()
+		default:
+		}
+
+		// Buffer whatever targets are immediately available so that they can be interleaved
+	fill:
+		for !queue.isFull() {
+			select {
+			case target, ok := <-targets:
+				if !ok {
+					targets = nil
+					continue
+				}
+				queue.push(target)
+			case now := <-checkC:
+				check(now)
+			default:
+				break fill
+			}
+		}
+
+		// Take the next target whose prefix is under its rate limit, otherwise send off what has
+		// been batched so far and wait for one to be
+		ip, wait := queue.next(time.Now())
+		if ip == nil {
+			flush()
+
+			// The scan is finished once there are no more targets coming in and none left to send or
+			// retry (which isn't known until the senders have finished with every batch)
+			outstanding := engine.retryCount > 0 && atomic.LoadInt64(&stats.outstanding) > 0
+			if targets == nil && queue.len() == 0 && !outstanding && !pending.hasRetriesRemaining() {
+				break
+			}
+
+			var input <-chan *net.IP
+			if !queue.isFull() {
+				input = targets
+			}
+			var ready <-chan time.Time
+			if wait > 0 {
+				ready = time.After(wait)
+			}
+			select {
+
+			// Read
+			case target, ok := <-input:
+				if !ok {
+					targets = nil
+					continue
+				}
+				queue.push(target)
+
+			// Retries
+			case now := <-checkC:
+				check(now)
+
+			// A prefix has come out from under its rate limit
+			case <-ready:
+
+			// The network is objecting to the scan
+			case <-tripped:
+			}
+			continue
+		}
+
+		if engine.isExcluded(ip, exclusions, stats) {
+			continue
+		}
+		batch.targets = append(batch.targets, ip)
+		if len(batch.targets) >= engine.batchSize {
+			flush()
+		}
+	}
+
+	// Wait for the senders to finish up
+	close(batches)
+	wg.Wait()
+	sent := atomic.LoadUint64(&stats.sent)
+	if elapsed := time.Since(start).Seconds(); sent > 0 && elapsed > 0 {
+		achieved := float64(sent) / elapsed
+		probeSentRateGauge.Update(achieved)
+		logging.Infof(
+			"Sent %.0f packets/second (%.2f Mbps on the wire) against a limit of %.0f packets/second.",
+			achieved,
+			achieved * float64(engine.wireSize * 8) / 1e6,
+			float64(engine.rateLimit),
+		)
+	}
+	if excluded := atomic.LoadUint64(&stats.excluded); excluded > 0 {
+		logging.Warnf("Dropped %d targets that fall within excluded networks (logged to '%s')", excluded, engine.exclusionLog)
+	}
+	if abandoned := atomic.LoadUint64(&stats.abandoned); abandoned > 0 {
+		logging.Warnf("Gave up on sending %d probes after the network stack repeatedly refused them", abandoned)
+	}
+	if cpu, ok := getCPUTime(); ok && sent > 0 {
+		perProbe := (cpu - startCPU) / time.Duration(sent)
+		probeCPUGauge.Update(int64(perProbe))
+		logging.Infof("Sending %d probes used %s of CPU time (%s per probe).", sent, cpu - startCPU, perProbe)
+	}
+	return sent, haltErr
+}
+
+// The replies that have been reported so far in a scan, shared between its receivers
+type reportedSet struct {
+	lock			sync.Mutex
+	responses		map[string]struct{}
+	targets			map[string]struct{}
+	typeTargets		map[string]struct{}
+	typeCounts		map[ResultType]uint64
+}
+
+func newReportedSet() *reportedSet {
+	return &reportedSet{
+		responses:		make(map[string]struct{}),
+		targets:		make(map[string]struct{}),
+		typeTargets:	make(map[string]struct{}),
+		typeCounts:		make(map[ResultType]uint64),
+	}
+}
+
+// Mark the target as having answered with the type of the result, returning whether this is the
+// first time that it has. Unlike reporting, this is tallied for every type of reply that a target
+// sends so that probe types can be compared when several are sent to each target.
+func (reported *reportedSet) answeredWith(result *Result) bool {
+	key := fmt.Sprintf("%d-%s", result.Type, result.Target)
+	reported.lock.Lock()
+	defer reported.lock.Unlock()
+	if _, ok := reported.typeTargets[key]; ok {
+		return false
+	}
+	reported.typeTargets[key] = struct{}{}
+	reported.typeCounts[result.Type]++
+	return true
+}
+
+// Get a summary of the number of targets that answered with each type of reply
+func (reported *reportedSet) getTypeSummary() string {
+	reported.lock.Lock()
+	defer reported.lock.Unlock()
+	var resultTypes []int
+	for resultType := range reported.typeCounts {
+		resultTypes = append(resultTypes, int(resultType))
+	}
+	sort.Ints(resultTypes)
+	var toReturn []string
+	for _, resultType := range resultTypes {
+		toReturn = append(toReturn, fmt.Sprintf("%d %s", reported.typeCounts[ResultType(resultType)], resultTypeNames[ResultType(resultType)]))
+	}
+	return strings.Join(toReturn, ", ")
+}
+
+// Mark the target as having answered, returning whether this is the first time that it has
+func (reported *reportedSet) answered(target *net.IP) bool {
+	reported.lock.Lock()
+	defer reported.lock.Unlock()
+	if _, ok := reported.targets[target.String()]; ok {
+		return false
+	}
+	reported.targets[target.String()] = struct{}{}
+	return true
+}
+
+// Mark the response as reported, returning false if an equivalent response already was. A target
+// is only reported as alive once (per hop limit when tracing) whichever probes it answered, while
+// each kind of error is reported separately.
+func (reported *reportedSet) add(result *Result) bool {
+	kind := -1
+	if result.IsError() {
+		kind = int(result.Type)
+	}
+	key := fmt.Sprintf("%d-%s-%d", kind, result.Target, result.Hop)
+	reported.lock.Lock()
+	defer reported.lock.Unlock()
+	if _, ok := reported.responses[key]; ok {
+		return false
+	}
+	reported.responses[key] = struct{}{}
+	return true
+}
+
+// Whether or not a read error is one that the receive loop should carry on after
+func isTemporaryReadError(err error) bool {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+	nerr, ok := err.(*net.OpError)
+	return ok && nerr.Temporary()
+}
+
+// The state that the receive processors of a scan share
+type receiver struct {
+	jar				*cookieJar
+	pending			*pendingSet
+	monitor			*safetyMonitor
+	reported		*reportedSet
+	results			chan<- *Result
+	counts			*replyCounts
+}
+
+// Count a reply that doesn't carry this scan's cookie (stray, spoofed, or left over from an earlier scan)
+func (recv *receiver) reject() {
+	atomic.AddUint64(&recv.counts.rejected, 1)
+	probeRejectedCount.Inc(1)
+}
+
+// Read packets from conn until it is closed, handing each one that arrived where the scan is bound
+// to on to handle along with its source address
+func (engine *Engine) readPackets(conn Conn, recv *receiver, handle func(b []byte, src net.IP, rcm *ipv6.ControlMessage, receivedAt time.Time)) {
+	buff := make([]byte, 1500)
+	for {
+		rlen, rcm, raddr, rerr := conn.ReadFrom(buff)
+		if rerr != nil {
+			if isTemporaryReadError(rerr) {
+				continue
+			}
+			break
+		}
+		receivedAt := time.Now()
+
+		// Drop packets that arrived on another interface or for another address than the scan is bound to
+		if !engine.isBoundTo(rcm) {
+			atomic.AddUint64(&recv.counts.foreign, 1)
+			probeForeignCount.Inc(1)
+			continue
+		}
+		ipAddr, ok := raddr.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		handle(buff[:rlen], ipAddr.IP, rcm, receivedAt)
+	}
+}
+
+func (engine *Engine) processReplies(conn Conn, recv *receiver, done chan bool) {
+	engine.readPackets(conn, recv, func(b []byte, src net.IP, rcm *ipv6.ControlMessage, receivedAt time.Time) {
+
+		// Parse the response
+		rm, err := icmp.ParseMessage(58, b)
+		if err != nil {
+			logging.Warnf("Error thrown when parsing ICMP message from %s: %s", src, err)
+			return
+		}
+		result, ok := parseResult(rm, src)
+		if !ok {
+			return
+		}
+		if !recv.jar.verifyResult(result, receivedAt) {
+			recv.reject()
+			return
+		}
+
+		// Trace probes carry the hop limit that they were sent with in their sequence number
+		if engine.tracing {
+			if result.protocol != 58 || result.seq < 1 || result.seq > len(engine.hopLimits) {
+				recv.reject()
+				return
+			}
+			result.Hop = result.seq
+		}
+
+		engine.report(result.Result, rcm, receivedAt, recv)
+	})
+	done <- true
+}
+
+func (engine *Engine) processTCPReplies(conn Conn, recv *receiver, done chan bool) {
+	engine.readPackets(conn, recv, func(b []byte, src net.IP, rcm *ipv6.ControlMessage, receivedAt time.Time) {
+
+		// Parse the response, ignoring any TCP traffic that couldn't be an answer to a SYN
+		segment, ok := parseTCPSegment(b)
+		if !ok {
+			return
+		}
+		result, ok := parseTCPResult(segment, src)
+		if !ok {
+			return
+		}
+
+		// The reply acknowledges the SYN cookie, and the port that the SYN was sent from says when
+		sentAt, ok := recv.jar.verifyPort(src, segment.srcPort, segment.dstPort, segment.ack - 1, 0xffffffff, receivedAt)
+		if !ok {
+			recv.reject()
+			return
+		}
+		result.SentAt = sentAt
+
+		engine.report(result, rcm, receivedAt, recv)
+	})
+	done <- true
+}
+
+func (engine *Engine) processUDPReplies(conn Conn, recv *receiver, done chan bool) {
+	engine.readPackets(conn, recv, func(b []byte, src net.IP, rcm *ipv6.ControlMessage, receivedAt time.Time) {
+
+		// Parse the response, ignoring any UDP traffic that isn't from a service that is probed
+		datagram, ok := parseUDPDatagram(b)
+		if !ok {
+			return
+		}
+		service, ok := udpServices[datagram.srcPort]
+		if !ok {
+			return
+		}
+		cookie, ok := service.replyCookie(datagram.payload)
+		if !ok {
+			return
+		}
+
+		// The reply echoes the cookie, and the port that the probe was sent from says when
+		sentAt, ok := recv.jar.verifyPort(src, datagram.srcPort, datagram.dstPort, cookie, service.mask, receivedAt)
+		if !ok {
+			recv.reject()
+			return
+		}
+		addr := src
+		engine.report(&Result{Type: UDP_REPLY, Addr: &addr, Target: &addr, Port: datagram.srcPort, SentAt: sentAt}, rcm, receivedAt, recv)
+	})
+	done <- true
+}
+
+// Report a verified response on the results channel unless an equivalent one already has been
+func (engine *Engine) report(result *Result, rcm *ipv6.ControlMessage, receivedAt time.Time, recv *receiver) {
+	recv.pending.answered(*result.Target, result.Addr.Equal(*result.Target))
+	recv.monitor.observe(result)
+	if recv.reported.answered(result.Target) {
+		atomic.AddUint64(&recv.counts.answered, 1)
+	}
+	if !result.IsError() && recv.reported.answeredWith(result) {
+		probeAnsweredByTypeCounts[result.Type].Inc(1)
+	}
+
+	if !recv.reported.add(result) {
+		atomic.AddUint64(&recv.counts.duplicates, 1)
+		probeDuplicateCount.Inc(1)
+		return
+	}
+
+	result.Phase = engine.phase
+	result.ReceivedAt = receivedAt
+	if rcm != nil {
+		result.HopLimit = rcm.HopLimit
+		result.IfIndex = rcm.IfIndex
+	}
+
+	// Time Exceeded errors are what a trace is looking for rather than a sign of trouble
+	if result.IsError() && !(engine.tracing && result.Type == TIME_EXCEEDED) {
+		atomic.AddUint64(&recv.counts.errors, 1)
+	} else {
+		atomic.AddUint64(&recv.counts.hits, 1)
+	}
+	recv.results <- result
+}
+
+// A response along with the fields of the probe that it answered that carry the probe's cookie -
+// the echo fields of echo requests, or the ports and cookie of TCP and UDP probes
+type signedResult struct {
+	*Result
+	protocol		int
+	id				int
+	seq				int
+	payload			[]byte
+	srcPort			int
+	cookie			uint32
+	cookieMask		uint32
+}
+
+// Convert an ICMPv6 message into a result, linking errors back to the probed target through the
+// packet that they quote
+func parseResult(msg *icmp.Message, src net.IP) (*signedResult, bool) {
+	var resultType ResultType
+	var data []byte
+	switch body := msg.Body.(type) {
+	case *icmp.Echo:
+		if msg.Type != ipv6.ICMPTypeEchoReply {
+			return nil, false
+		}
+		addr := src
+		return &signedResult{
+			Result:		&Result{Type: ECHO_REPLY, Addr: &addr, Target: &addr},
+			protocol:	58,
+			id:			body.ID,
+			seq:		body.Seq,
+			payload:	body.Data,
+		}, true
+	case *icmp.DstUnreach:
+		resultType, data = DESTINATION_UNREACHABLE, body.Data
+	case *icmp.PacketTooBig:
+		resultType, data = PACKET_TOO_BIG, body.Data
+	case *icmp.TimeExceeded:
+		resultType, data = TIME_EXCEEDED, body.Data
+	case *icmp.ParamProb:
+		resultType, data = PARAMETER_PROBLEM, body.Data
+	default:
+		return nil, false
+	}
+	quoted, ok := parseQuotedProbe(data)
+	if !ok {
+		return nil, false
+	}
+	// Only the probed host itself complains about an unrecognized destination option
+	if resultType == PARAMETER_PROBLEM && (msg.Code != paramProblemUnrecognizedOption || !src.Equal(quoted.dst)) {
+		return nil, false
+	}
+	addr := src
+	toReturn := &signedResult{
+		Result:		&Result{Type: resultType, Code: msg.Code, Addr: &addr, Target: &quoted.dst},
+		protocol:	quoted.protocol,
+		id:			quoted.id,
+		seq:		quoted.seq,
+		payload:	quoted.payload,
+		srcPort:	quoted.srcPort,
+	}
+	switch quoted.protocol {
+	case 6:
+		toReturn.Port = quoted.dstPort
+		toReturn.cookie, toReturn.cookieMask = quoted.tcpSeq, 0xffffffff
+	case 17:
+		service, ok := udpServices[quoted.dstPort]
+		if !ok {
+			return nil, false
+		}
+		if toReturn.cookie, ok = service.requestCookie(quoted.payload); !ok {
+			return nil, false
+		}
+		toReturn.Port = quoted.dstPort
+		toReturn.cookieMask = service.mask
+
+		// A host that says that nothing is listening on the port is still a host
+		if resultType == DESTINATION_UNREACHABLE && msg.Code == 4 && src.Equal(quoted.dst) {
+			toReturn.Type = PORT_UNREACHABLE
+		}
+	}
+	return toReturn, true
+}
@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/blacklist"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var probeExcludedCount = metrics.NewCounter()
+
+func init() {
+	metrics.Register("probe.excluded.count", probeExcludedCount)
+}
+
+// Read the list of networks that must never be probed from filePath. Each line holds an IPv6
+// network in CIDR notation or a single IPv6 address, and anything after a '#' is a comment. A
+// missing file is an empty list, but a line that can't be parsed is an error so that a typo never
+// quietly lets probes through.
+func ReadExclusionsFromFile(filePath string) (*blacklist.NetworkBlacklist, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return blacklist.NewNetworkBlacklist(nil), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Every entry is kept, as the blacklist would otherwise skip a network whose first and last
+	// addresses are covered by earlier entries even when the rest of it is not
+	exclusions := blacklist.NewNetworkBlacklist(nil)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		network, err := parseExclusion(line)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid exclusion on line %d of '%s': %s", lineNumber, filePath, err))
+		}
+		exclusions.AddNetworkUnconditionally(network)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exclusions, nil
+}
+
+func parseExclusion(toParse string) (*net.IPNet, error) {
+	if !strings.Contains(toParse, "/") {
+		toParse += "/128"
+	}
+	ip, network, err := net.ParseCIDR(toParse)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() != nil || len(network.IP) != net.IPv6len {
+		return nil, errors.New(fmt.Sprintf("'%s' is not an IPv6 network", toParse))
+	}
+	return network, nil
+}
+
+// An exclusionLog records the targets that were dropped because they fall within an excluded
+// network. The file is only created once a target is dropped.
+type exclusionLog struct {
+	filePath		string
+	file			*os.File
+	writer			*bufio.Writer
+}
+
+func newExclusionLog(filePath string) *exclusionLog {
+	return &exclusionLog{filePath: filePath}
+}
+
+func (exclusions *exclusionLog) write(target *net.IP, network *net.IPNet) {
+	if exclusions.writer == nil {
+		file, err := os.OpenFile(exclusions.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logging.Warnf("Error thrown when opening excluded target log (path '%s'): %s", exclusions.filePath, err)
+			return
+		}
+		exclusions.file = file
+		exclusions.writer = bufio.NewWriter(file)
+	}
+	fmt.Fprintf(exclusions.writer, "%s %s %s\n", time.Now().UTC().Format(time.RFC3339), target, network)
+}
+
+func (exclusions *exclusionLog) close() {
+	if exclusions.file == nil {
+		return
+	}
+	exclusions.writer.Flush()
+	exclusions.file.Close()
+}
+
+// Check whether a target falls within an excluded network, counting and logging it if it does
+func (engine *Engine) isExcluded(target *net.IP, exclusions *exclusionLog, stats *sendStats) bool {
+	if engine.exclusions.GetCount() == 0 {
+		return false
+	}
+	addr := target.To16()
+	network := engine.exclusions.GetBlacklistingNetworkFromIP(&addr)
+	if network == nil {
+		return false
+	}
+	probeExcludedCount.Inc(1)
+	atomic.AddUint64(&stats.excluded, 1)
+	logging.Debugf("Not probing %s as it falls within excluded network %s.", target, network)
+	exclusions.write(target, network)
+	return true
+}
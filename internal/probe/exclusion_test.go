@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func writeExclusions(content string) string {
+	file, _ := ioutil.TempFile("", "exclusions")
+	file.WriteString(content)
+	file.Close()
+	return file.Name()
+}
+
+func TestReadExclusionsFromFile(t *testing.T) {
+	filePath := writeExclusions("# Our own infrastructure\n2001:db8:1::/48\n\n2001:db8:2::5  # A customer\n")
+	defer os.Remove(filePath)
+	exclusions, err := ReadExclusionsFromFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, exclusions.GetCount())
+	for _, addr := range []string{"2001:db8:1::1", "2001:db8:1:ffff::1", "2001:db8:2::5"} {
+		ip := net.ParseIP(addr)
+		assert.True(t, exclusions.IsIPBlacklisted(&ip), addr)
+	}
+	for _, addr := range []string{"2001:db8:2::6", "2001:db8:3::1"} {
+		ip := net.ParseIP(addr)
+		assert.False(t, exclusions.IsIPBlacklisted(&ip), addr)
+	}
+}
+
+func TestReadExclusionsFromFile_OverlappingAndOutOfOrder(t *testing.T) {
+	filePath := writeExclusions("2001:db8::\n2001:db8:ffff:ffff:ffff:ffff:ffff:ffff\n2001:db8::/32\n2001:db8:1::/48\n2001:db8::/32\n")
+	defer os.Remove(filePath)
+	exclusions, err := ReadExclusionsFromFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, exclusions.GetCount())
+	for _, addr := range []string{"2001:db8::", "2001:db8::5", "2001:db8:1::1", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"} {
+		ip := net.ParseIP(addr)
+		assert.True(t, exclusions.IsIPBlacklisted(&ip), addr)
+	}
+	ip := net.ParseIP("2001:db9::1")
+	assert.False(t, exclusions.IsIPBlacklisted(&ip))
+}
+
+func TestReadExclusionsFromFile_Missing(t *testing.T) {
+	exclusions, err := ReadExclusionsFromFile("/nonexistent/exclusions.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exclusions.GetCount())
+}
+
+func TestReadExclusionsFromFile_Invalid(t *testing.T) {
+	for _, content := range []string{"2001:db8:1::/48\nnot a network\n", "10.0.0.0/8\n"} {
+		filePath := writeExclusions(content)
+		_, err := ReadExclusionsFromFile(filePath)
+		os.Remove(filePath)
+		assert.NotNil(t, err, content)
+	}
+}
@@ -0,0 +1,423 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/blacklist"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/spf13/viper"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/time/rate"
+	"net"
+	"sync"
+	"time"
+)
+
+// The all-nodes link-local multicast group, which every IPv6 host on a link is a member of
+var allNodesGroup = net.ParseIP("ff02::1")
+
+// The prefix length of the on-link networks that candidate neighbors are solicited in
+const onLinkPrefixLength = 64
+
+// Neighbor Discovery messages are sent and only accepted with the maximum hop limit, which proves
+// that they weren't forwarded by a router (RFC 4861)
+const ndHopLimit = 255
+
+// The length of a Neighbor Solicitation carrying an Ethernet source link-layer address
+const neighborSolicitationLength = 32
+
+const (
+	ndOptionSourceLinkLayer			= 1
+	ndOptionPrefixInformation		= 3
+	prefixFlagOnLink				= 0x80
+)
+
+// Produces the candidate addresses to solicit within an on-link network
+type CandidateGenerator func(prefix *net.IPNet) ([]*net.IP, error)
+
+// A LocalScanner finds the hosts on the link attached to an interface. It pings the all-nodes
+// multicast group, collects the Router Advertisements that routers on the link send, and then sends
+// Neighbor Solicitations for candidate addresses in the link's /64 networks (those assigned to the
+// interface and those that routers advertise).
+type LocalScanner struct {
+	transport		Transport
+	ifIndex			int
+	source			net.IP
+	hwAddr			net.HardwareAddr
+	prefixes		[]*net.IPNet
+	rateLimit		rate.Limit
+	listenTimeout	time.Duration
+	exclusions		*blacklist.NetworkBlacklist
+}
+
+// Create a scanner for the link attached to the named interface that solicits neighbors at no more
+// than bandwidth worth of packets (or PingScanRate packets per second if set), and that listens for
+// listenTimeout after pinging the link and again after the last solicitation
+func NewLocalScanner(interfaceName string, bandwidth string, listenTimeout time.Duration) (*LocalScanner, error) {
+	if interfaceName == "" {
+		return nil, errors.New("Local scans must be given the interface that the link to scan is attached to.")
+	}
+	ifIndex, source, err := ResolveBinding(interfaceName, viper.GetString("PingScanSourceAddress"))
+	if err != nil {
+		return nil, err
+	}
+	iface, err := net.InterfaceByIndex(ifIndex)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not find network interface '%s': %s", interfaceName, err))
+	}
+	targetRate, err := getProbeRate(bandwidth, viper.GetFloat64("PingScanRate"), getWireSize(neighborSolicitationLength))
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := ReadExclusionsFromFile(config.GetExclusionFilePath())
+	if err != nil {
+		return nil, err
+	}
+	return &LocalScanner{
+		transport:		curTransport,
+		ifIndex:		ifIndex,
+		source:			source,
+		hwAddr:			iface.HardwareAddr,
+		prefixes:		getOnLinkPrefixes(iface),
+		rateLimit:		rate.Limit(targetRate),
+		listenTimeout:	listenTimeout,
+		exclusions:		exclusions,
+	}, nil
+}
+
+func NewLocalScannerFromConfig() (*LocalScanner, error) {
+	return NewLocalScanner(viper.GetString("PingScanInterface"), viper.GetString("PingScanBandwidth"), config.GetLocalScanListenDuration())
+}
+
+// Get the /64 networks of the global addresses assigned to an interface
+func getOnLinkPrefixes(iface *net.Interface) []*net.IPNet {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var toReturn []*net.IPNet
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() != nil || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		mask := net.CIDRMask(onLinkPrefixLength, 128)
+		toReturn = append(toReturn, &net.IPNet{IP: ipNet.IP.Mask(mask), Mask: mask})
+	}
+	return toReturn
+}
+
+// Get the solicited-node multicast group that Neighbor Solicitations for addr are sent to
+func getSolicitedNodeGroup(addr net.IP) net.IP {
+	toReturn := net.ParseIP("ff02::1:ff00:0")
+	copy(toReturn[13:], addr.To16()[13:])
+	return toReturn
+}
+
+// Build a Neighbor Solicitation for target, including the link-layer address that the answer should
+// be sent to if there is one. The checksum is left for the kernel to compute.
+func newNeighborSolicitation(target net.IP, hwAddr net.HardwareAddr) []byte {
+	data := make([]byte, 20)
+	copy(data[4:], target.To16())
+	if len(hwAddr) > 0 {
+		option := make([]byte, (2 + len(hwAddr) + 7) / 8 * 8)
+		option[0] = ndOptionSourceLinkLayer
+		option[1] = byte(len(option) / 8)
+		copy(option[2:], hwAddr)
+		data = append(data, option...)
+	}
+	msg := icmp.Message{
+		Type:	ipv6.ICMPTypeNeighborSolicitation,
+		Body:	&icmp.DefaultMessageBody{Data: data},
+	}
+	toReturn, _ := msg.Marshal(nil)
+	return toReturn
+}
+
+// Get the on-link /64 networks from the Prefix Information options of a Router Advertisement body
+func getAdvertisedPrefixes(data []byte) []*net.IPNet {
+	var toReturn []*net.IPNet
+	if len(data) < 12 {
+		return nil
+	}
+	options := data[12:]
+	for len(options) >= 8 {
+		length := int(options[1]) * 8
+		if length == 0 || length > len(options) {
+			break
+		}
+		if options[0] == ndOptionPrefixInformation && length == 32 && options[2] == onLinkPrefixLength && options[3] & prefixFlagOnLink != 0 {
+			mask := net.CIDRMask(onLinkPrefixLength, 128)
+			prefix := make(net.IP, 16)
+			copy(prefix, options[16:32])
+			toReturn = append(toReturn, &net.IPNet{IP: prefix.Mask(mask), Mask: mask})
+		}
+		options = options[length:]
+	}
+	return toReturn
+}
+
+// The state that a local scan shares between its sender and receiver
+type localState struct {
+	lock			sync.Mutex
+	solicited		map[string]time.Time
+	prefixes		[]*net.IPNet
+	reported		map[string]struct{}
+	results			[]*Result
+}
+
+func newLocalState(prefixes []*net.IPNet) *localState {
+	toReturn := &localState{
+		solicited:	make(map[string]time.Time),
+		reported:	make(map[string]struct{}),
+	}
+	for _, prefix := range prefixes {
+		toReturn.addPrefix(prefix)
+	}
+	return toReturn
+}
+
+// Add an on-link network to solicit candidates in (the lock must be held once the scan has started)
+func (state *localState) addPrefix(prefix *net.IPNet) {
+	for _, existing := range state.prefixes {
+		if existing.String() == prefix.String() {
+			return
+		}
+	}
+	state.prefixes = append(state.prefixes, prefix)
+}
+
+func (state *localState) getPrefixes() []*net.IPNet {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return append([]*net.IPNet{}, state.prefixes...)
+}
+
+func (state *localState) solicit(target net.IP, sentAt time.Time) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.solicited[target.String()] = sentAt
+}
+
+// Get when the given address was solicited, if it was. Neighbor Advertisements carry nothing that
+// can be signed, so only those for addresses that were solicited in this scan are accepted.
+func (state *localState) getSolicitedAt(target net.IP) (time.Time, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	sentAt, ok := state.solicited[target.String()]
+	return sentAt, ok
+}
+
+// Record the result unless an equivalent one already was
+func (state *localState) report(result *Result) {
+	key := fmt.Sprintf("%d-%s-%s", result.Type, result.Addr, result.Target)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if _, ok := state.reported[key]; ok {
+		return
+	}
+	state.reported[key] = struct{}{}
+	state.results = append(state.results, result)
+}
+
+func (state *localState) getResults() []*Result {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return append([]*Result{}, state.results...)
+}
+
+// Scan the link, soliciting the candidates that generate produces for each on-link network, and
+// return the hosts and routers that answered or advertised themselves
+func (scanner *LocalScanner) Scan(generate CandidateGenerator) ([]*Result, error) {
+
+	// Generate the secret that the multicast ping is signed with
+	jar, err := newCookieJar()
+	if err != nil {
+		logging.Warnf("Error thrown when creating probe cookies: %s", err.Error())
+		return nil, err
+	}
+
+	conn, err := scanner.transport.Listen(58)
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
+		return nil, err
+	}
+	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		logging.Warnf("Error thrown when setting control message: %s", err.Error())
+		conn.Close()
+		return nil, err
+	}
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeEchoReply)
+	filter.Accept(ipv6.ICMPTypeNeighborAdvertisement)
+	filter.Accept(ipv6.ICMPTypeRouterAdvertisement)
+	if err := conn.SetICMPFilter(&filter); err != nil {
+		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+		conn.Close()
+		return nil, err
+	}
+
+	state := newLocalState(scanner.prefixes)
+	done := make(chan struct{})
+	go func() {
+		scanner.processLocalReplies(conn, jar, state)
+		close(done)
+	}()
+	stop := func() {
+		conn.Close()
+		<-done
+	}
+	wcm := &ipv6.ControlMessage{HopLimit: ndHopLimit, Src: scanner.source, IfIndex: scanner.ifIndex}
+
+	// Ping every node on the link, and give routers a chance to advertise themselves
+	echoID, echoData := jar.sign(allNodesGroup, time.Now())
+	echo := icmp.Message{
+		Type:	ipv6.ICMPTypeEchoRequest,
+		Body:	&icmp.Echo{ID: echoID, Seq: 0, Data: echoData},
+	}
+	echoBytes, err := echo.Marshal(nil)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if _, err := conn.WriteTo(echoBytes, wcm, &net.IPAddr{IP: allNodesGroup}); err != nil {
+		logging.Warnf("Error thrown when pinging all nodes on the link: %s", err)
+	}
+	logging.Infof("Pinged all nodes on the link. Waiting %s for replies and Router Advertisements.", scanner.listenTimeout)
+	time.Sleep(scanner.listenTimeout)
+
+	// Solicit candidates in every on-link network, including any that routers have advertised
+	limiter := rate.NewLimiter(scanner.rateLimit, 10)
+	ctx := context.Background()
+	solicited, excluded := 0, 0
+	prefixes := state.getPrefixes()
+	if len(prefixes) == 0 {
+		logging.Warnf("No on-link networks were found to solicit candidate addresses in.")
+	}
+	for _, prefix := range prefixes {
+		candidates, err := generate(prefix)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		logging.Infof("Soliciting %d candidate addresses in on-link network %s.", len(candidates), prefix)
+		for _, candidate := range candidates {
+			target := candidate.To16()
+			if scanner.exclusions.GetCount() > 0 && scanner.exclusions.IsIPBlacklisted(&target) {
+				excluded++
+				continue
+			}
+			limiter.Wait(ctx)
+			state.solicit(target, time.Now())
+			if _, err := conn.WriteTo(newNeighborSolicitation(target, scanner.hwAddr), wcm, &net.IPAddr{IP: getSolicitedNodeGroup(target)}); err != nil {
+				logging.Debugf("Error thrown when soliciting %s: %s", target, err)
+				continue
+			}
+			solicited++
+		}
+	}
+	if excluded > 0 {
+		logging.Warnf("Dropped %d candidate addresses that fall within excluded networks", excluded)
+	}
+	logging.Infof("Sent %d Neighbor Solicitations. Waiting %s for late replies.", solicited, scanner.listenTimeout)
+	time.Sleep(scanner.listenTimeout)
+
+	stop()
+	return state.getResults(), nil
+}
+
+// Read replies and advertisements from conn until it is closed, recording those that arrived on
+// the scanned link and that are for this scan
+func (scanner *LocalScanner) processLocalReplies(conn Conn, jar *cookieJar, state *localState) {
+	buff := make([]byte, 1500)
+	for {
+		rlen, rcm, raddr, rerr := conn.ReadFrom(buff)
+		if rerr != nil {
+			if isTemporaryReadError(rerr) {
+				continue
+			}
+			break
+		}
+		receivedAt := time.Now()
+		if rcm != nil && rcm.IfIndex != scanner.ifIndex {
+			continue
+		}
+		ipAddr, ok := raddr.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		msg, err := icmp.ParseMessage(58, buff[:rlen])
+		if err != nil {
+			logging.Warnf("Error thrown when parsing ICMP message from %s: %s", ipAddr.IP, err)
+			continue
+		}
+		result, ok := parseLocalResult(msg, ipAddr.IP, rcm, jar, state, receivedAt)
+		if !ok {
+			continue
+		}
+		result.Phase = PHASE_LOCAL
+		result.ReceivedAt = receivedAt
+		if rcm != nil {
+			result.HopLimit = rcm.HopLimit
+			result.IfIndex = rcm.IfIndex
+		}
+		state.report(result)
+	}
+}
+
+// Convert a reply to the multicast ping, a Neighbor Advertisement for a solicited address, or a
+// Router Advertisement into a result, learning the on-link networks that routers advertise
+func parseLocalResult(msg *icmp.Message, src net.IP, rcm *ipv6.ControlMessage, jar *cookieJar, state *localState, receivedAt time.Time) (*Result, bool) {
+	addr := make(net.IP, len(src))
+	copy(addr, src)
+	if msg.Type == ipv6.ICMPTypeEchoReply {
+		body, ok := msg.Body.(*icmp.Echo)
+		if !ok {
+			return nil, false
+		}
+		sentAt, ok := jar.verify(allNodesGroup, body.ID, body.Data)
+		if !ok {
+			return nil, false
+		}
+		return &Result{Type: ECHO_REPLY, Addr: &addr, Target: &addr, SentAt: sentAt}, true
+	}
+
+	// Neighbor Discovery messages that a router may have forwarded are not to be trusted
+	if rcm != nil && rcm.HopLimit != ndHopLimit {
+		return nil, false
+	}
+	body, ok := msg.Body.(*icmp.DefaultMessageBody)
+	if !ok {
+		return nil, false
+	}
+	switch msg.Type {
+	case ipv6.ICMPTypeNeighborAdvertisement:
+		if len(body.Data) < 20 {
+			return nil, false
+		}
+		target := make(net.IP, 16)
+		copy(target, body.Data[4:20])
+		sentAt, ok := state.getSolicitedAt(target)
+		if !ok {
+			return nil, false
+		}
+		return &Result{Type: NEIGHBOR_ADVERTISEMENT, Addr: &addr, Target: &target, SentAt: sentAt}, true
+	case ipv6.ICMPTypeRouterAdvertisement:
+		if !src.IsLinkLocalUnicast() || len(body.Data) < 12 {
+			return nil, false
+		}
+		for _, prefix := range getAdvertisedPrefixes(body.Data) {
+			state.lock.Lock()
+			state.addPrefix(prefix)
+			state.lock.Unlock()
+		}
+
+		// Advertisements aren't asked for, so they have no round trip time
+		return &Result{Type: ROUTER_ADVERTISEMENT, Addr: &addr, Target: &addr, SentAt: receivedAt}, true
+	}
+	return nil, false
+}
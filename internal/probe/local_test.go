@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGetSolicitedNodeGroup(t *testing.T) {
+	assert.Equal(t, "ff02::1:ffab:cdef", getSolicitedNodeGroup(net.ParseIP("2001:db8::12ab:cdef")).String())
+}
+
+func TestNewNeighborSolicitation(t *testing.T) {
+	target := net.ParseIP("2001:db8::1")
+	hwAddr, _ := net.ParseMAC("00:11:22:33:44:55")
+	b := newNeighborSolicitation(target, hwAddr)
+	assert.Len(t, b, neighborSolicitationLength)
+	msg, err := icmp.ParseMessage(58, b)
+	assert.Nil(t, err)
+	assert.Equal(t, ipv6.ICMPTypeNeighborSolicitation, msg.Type)
+	assert.Equal(t, target, net.IP(b[8:24]))
+	assert.EqualValues(t, ndOptionSourceLinkLayer, b[24])
+	assert.EqualValues(t, 1, b[25])
+	assert.Equal(t, hwAddr, net.HardwareAddr(b[26:32]))
+
+	// Interfaces without a link-layer address leave the option out
+	assert.Len(t, newNeighborSolicitation(target, nil), 24)
+}
+
+func TestGetAdvertisedPrefixes(t *testing.T) {
+	data := make([]byte, 12)
+	data = append(data, ndOptionSourceLinkLayer, 1, 0, 0x11, 0x22, 0x33, 0x44, 0x55)
+	for _, prefix := range []struct {
+		addr		string
+		length		byte
+		flags		byte
+	}{
+		{"2001:db8:1::", 64, prefixFlagOnLink},
+		{"2001:db8:2::", 64, 0},
+		{"2001:db8:3::", 48, prefixFlagOnLink},
+	} {
+		option := make([]byte, 32)
+		option[0], option[1], option[2], option[3] = ndOptionPrefixInformation, 4, prefix.length, prefix.flags
+		copy(option[16:], net.ParseIP(prefix.addr))
+		data = append(data, option...)
+	}
+	prefixes := getAdvertisedPrefixes(data)
+	assert.Len(t, prefixes, 1)
+	assert.Equal(t, "2001:db8:1::/64", prefixes[0].String())
+
+	// A zero-length option ends parsing rather than looping forever
+	assert.Len(t, getAdvertisedPrefixes(append(make([]byte, 12), 1, 0, 0, 0, 0, 0, 0, 0)), 0)
+}
+
+func TestParseLocalResult_RejectsUnsolicitedAdvertisements(t *testing.T) {
+	state := newLocalState(nil)
+	target := net.ParseIP("2001:db8::1")
+	data := make([]byte, 20)
+	copy(data[4:], target)
+	msg := &icmp.Message{Type: ipv6.ICMPTypeNeighborAdvertisement, Body: &icmp.DefaultMessageBody{Data: data}}
+	rcm := &ipv6.ControlMessage{HopLimit: ndHopLimit}
+	_, ok := parseLocalResult(msg, target, rcm, nil, state, time.Now())
+	assert.False(t, ok)
+
+	state.solicit(target, time.Now())
+	_, ok = parseLocalResult(msg, target, &ipv6.ControlMessage{HopLimit: 64}, nil, state, time.Now())
+	assert.False(t, ok)
+	result, ok := parseLocalResult(msg, target, rcm, nil, state, time.Now())
+	assert.True(t, ok)
+	assert.Equal(t, NEIGHBOR_ADVERTISEMENT, result.Type)
+}
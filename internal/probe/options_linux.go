@@ -0,0 +1,18 @@
+// +build linux
+
+package probe
+
+import "syscall"
+
+// Add the given Destination Options header to every packet sent from the socket from now on. The
+// kernel fills in the header's next header field.
+func (conn *rawConn) SetDestinationOptions(header []byte) error {
+	var sockErr error
+	err := conn.raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptString(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_DSTOPTS, string(header))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
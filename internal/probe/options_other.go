@@ -0,0 +1,9 @@
+// +build !linux
+
+package probe
+
+import "errors"
+
+func (conn *rawConn) SetDestinationOptions(header []byte) error {
+	return errors.New("Destination Options headers can only be added to probes on Linux.")
+}
@@ -0,0 +1,20 @@
+package probe
+
+// The Destination Options header that Parameter Problem probes carry (its next header field is
+// filled in by the kernel). The header holds a single option of type 0x9e, one of the types that
+// RFC 4727 reserves for RFC 3692-style experiments, which hosts don't implement unless they are
+// taking part in one. It is padded out to eight bytes. The two high-order bits of the type (10) tell whoever the
+// probe is addressed to that they must discard it and answer with a Parameter Problem (code 2,
+// unrecognized IPv6 option) pointing at the option, whether or not it was addressed to a multicast
+// address. Hosts that filter echo requests often still process extension headers, so this draws
+// replies out of hosts that echo probes can't.
+var paramProblemOptions = []byte{
+	0,				// Next header
+	0,				// Header length in 8-byte units, not counting the first
+	0x9e,			// Option type (skip bits 10, change bit 0, RFC 3692-style experiment)
+	4,				// Option length
+	0, 0, 0, 0,
+}
+
+// The ICMPv6 Parameter Problem code for an unrecognized IPv6 option
+const paramProblemUnrecognizedOption = 2
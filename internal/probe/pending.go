@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type pendingProbe struct {
+	addr			*net.IP
+	attempts		int
+	lastSent		time.Time
+}
+
+// A pendingSet tracks the targets that have been probed but not yet answered so that they can be
+// retried, and keeps the counts needed to estimate packet loss over the course of a scan
+type pendingSet struct {
+	lock			sync.Mutex
+	probes			map[[16]byte]*pendingProbe
+	maxAttempts		int
+	retryTimeout	time.Duration
+	answeredCount	int
+	answeredSent	int
+	retryCount		int
+}
+
+func newPendingSet(retryCount int, retryTimeout time.Duration) *pendingSet {
+	return &pendingSet{
+		probes:			make(map[[16]byte]*pendingProbe),
+		maxAttempts:	retryCount + 1,
+		retryTimeout:	retryTimeout,
+	}
+}
+
+func pendingKey(addr net.IP) [16]byte {
+	var key [16]byte
+	copy(key[:], addr.To16())
+	return key
+}
+
+// Record that a probe was sent to addr
+func (set *pendingSet) sent(addr *net.IP, at time.Time) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	key := pendingKey(*addr)
+	if probe, ok := set.probes[key]; ok {
+		probe.attempts++
+		probe.lastSent = at
+		set.retryCount++
+		return
+	}
+	set.probes[key] = &pendingProbe{
+		addr:		addr,
+		attempts:	1,
+		lastSent:	at,
+	}
+}
+
+// Record that a response was received for addr. Only responses from addr itself count toward the
+// loss estimate, as an error from a router along the way says little about the probes that reach it.
+func (set *pendingSet) answered(addr net.IP, fromTarget bool) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	key := pendingKey(addr)
+	if probe, ok := set.probes[key]; ok {
+		if fromTarget {
+			set.answeredCount++
+			set.answeredSent += probe.attempts
+		}
+		delete(set.probes, key)
+	}
+}
+
+// Get the targets whose most recent probe has gone unanswered for longer than the retry timeout and
+// that have attempts remaining, restarting their timeouts. Targets that are out of attempts are
+// forgotten.
+func (set *pendingSet) due(now time.Time) []*net.IP {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	var toReturn []*net.IP
+	for key, probe := range set.probes {
+		if now.Sub(probe.lastSent) < set.retryTimeout {
+			continue
+		}
+		if probe.attempts >= set.maxAttempts {
+			delete(set.probes, key)
+			continue
+		}
+		probe.lastSent = now
+		toReturn = append(toReturn, probe.addr)
+	}
+	return toReturn
+}
+
+// Whether or not any of the unanswered targets will be retried
+func (set *pendingSet) hasRetriesRemaining() bool {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	for _, probe := range set.probes {
+		if probe.attempts < set.maxAttempts {
+			return true
+		}
+	}
+	return false
+}
+
+// Estimate the fraction of packets lost in the scan from the number of attempts that it took for
+// responsive targets to answer. Returns false if no targets answered.
+func (set *pendingSet) estimateLoss() (float64, bool) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.answeredSent == 0 {
+		return 0, false
+	}
+	return float64(set.answeredSent - set.answeredCount) / float64(set.answeredSent), true
+}
+
+func (set *pendingSet) getRetryCount() int {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	return set.retryCount
+}
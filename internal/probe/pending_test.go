@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPendingSet_RetriesUnansweredTargets(t *testing.T) {
+	set := newPendingSet(1, time.Second)
+	addr := net.ParseIP("2001:db8::1")
+	start := time.Now()
+	set.sent(&addr, start)
+	assert.Len(t, set.due(start), 0)
+	assert.Len(t, set.due(start.Add(time.Second)), 1)
+	set.sent(&addr, start.Add(time.Second))
+	assert.False(t, set.hasRetriesRemaining())
+	assert.Len(t, set.due(start.Add(3 * time.Second)), 0)
+	assert.Len(t, set.probes, 0)
+}
+
+func TestPendingSet_EstimatesLoss(t *testing.T) {
+	set := newPendingSet(3, time.Second)
+	first := net.ParseIP("2001:db8::1")
+	second := net.ParseIP("2001:db8::2")
+	now := time.Now()
+	set.sent(&first, now)
+	set.sent(&first, now)
+	set.sent(&first, now)
+	set.sent(&second, now)
+	set.answered(first, true)
+	set.answered(second, true)
+	loss, ok := set.estimateLoss()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.5, loss, 0.001)
+	assert.Equal(t, 2, set.getRetryCount())
+}
+
+func TestPendingSet_IgnoresRouterErrorsInLossEstimate(t *testing.T) {
+	set := newPendingSet(3, time.Second)
+	addr := net.ParseIP("2001:db8::1")
+	now := time.Now()
+	set.sent(&addr, now)
+	set.sent(&addr, now)
+	set.answered(addr, false)
+	_, ok := set.estimateLoss()
+	assert.False(t, ok)
+	assert.Len(t, set.probes, 0)
+}
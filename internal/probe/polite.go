@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"net"
+	"time"
+)
+
+// The maximum number of targets to buffer while looking for targets in other prefixes
+const politeQueueSize = 16384
+
+// Get the maximum number of targets that an engine will have read from its targets channel without
+// having sent them yet. Besides the polite queue and the target being queued, there is the batch
+// being filled, the batches waiting for a sender, and the batch that each sender is sending.
+func GetMaxQueuedTargets(batchSize int, senderCount int) int {
+	return politeQueueSize + 1 + batchSize * (2 * senderCount + 1)
+}
+
+type prefixBucket struct {
+	key				[16]byte
+	targets			[]*net.IP
+	nextAllowed		time.Time
+}
+
+// A politeQueue buffers targets by the prefix that they fall within and hands them back out in
+// round-robin order across prefixes, never releasing targets within a single prefix faster than
+// the configured per-prefix rate
+type politeQueue struct {
+	prefixMask		net.IPMask
+	interval		time.Duration
+	buckets			map[[16]byte]*prefixBucket
+	order			[]*prefixBucket
+	cursor			int
+	size			int
+}
+
+// Create a queue that groups targets by prefixes of prefixLength bits and releases at most
+// prefixRate targets per second from each prefix (unlimited if prefixRate is not positive)
+func newPoliteQueue(prefixLength int, prefixRate float64) *politeQueue {
+	var interval time.Duration
+	if prefixRate > 0 {
+		interval = time.Duration(float64(time.Second) / prefixRate)
+	}
+	return &politeQueue{
+		prefixMask:		net.CIDRMask(prefixLength, 128),
+		interval:		interval,
+		buckets:		make(map[[16]byte]*prefixBucket),
+	}
+}
+
+func (queue *politeQueue) push(addr *net.IP) {
+	var key [16]byte
+	copy(key[:], addr.To16().Mask(queue.prefixMask))
+	bucket, ok := queue.buckets[key]
+	if !ok {
+		bucket = &prefixBucket{key: key}
+		queue.buckets[key] = bucket
+		queue.order = append(queue.order, bucket)
+	}
+	bucket.targets = append(bucket.targets, addr)
+	queue.size++
+}
+
+func (queue *politeQueue) len() int {
+	return queue.size
+}
+
+func (queue *politeQueue) isFull() bool {
+	return queue.size >= politeQueueSize
+}
+
+// Get the next target that may be sent to. If no target is ready then nil is returned along with
+// how long to wait until one will be (zero if the queue is empty).
+func (queue *politeQueue) next(now time.Time) (*net.IP, time.Duration) {
+	var wait time.Duration
+	for checked := 0; checked < len(queue.order); {
+		if queue.cursor >= len(queue.order) {
+			queue.cursor = 0
+		}
+		bucket := queue.order[queue.cursor]
+
+		// Forget about prefixes that have no targets once their rate limit no longer applies
+		if len(bucket.targets) == 0 {
+			if !now.Before(bucket.nextAllowed) {
+				delete(queue.buckets, bucket.key)
+				queue.order = append(queue.order[:queue.cursor], queue.order[queue.cursor + 1:]...)
+				continue
+			}
+			queue.cursor++
+			checked++
+			continue
+		}
+
+		if now.Before(bucket.nextAllowed) {
+			if untilAllowed := bucket.nextAllowed.Sub(now); wait == 0 || untilAllowed < wait {
+				wait = untilAllowed
+			}
+			queue.cursor++
+			checked++
+			continue
+		}
+
+		addr := bucket.targets[0]
+		bucket.targets[0] = nil
+		bucket.targets = bucket.targets[1:]
+		bucket.nextAllowed = now.Add(queue.interval)
+		queue.size--
+		queue.cursor++
+		return addr, 0
+	}
+	return nil, wait
+}
@@ -0,0 +1,40 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func pushTestingIPs(queue *politeQueue, addrs ...string) {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		queue.push(&ip)
+	}
+}
+
+func TestPoliteQueue_InterleavesPrefixes(t *testing.T) {
+	queue := newPoliteQueue(48, 0)
+	pushTestingIPs(queue, "2001:db8:1::1", "2001:db8:1::2", "2001:db8:1::3", "2001:db8:2::1")
+	now := time.Now()
+	var order []string
+	for queue.len() > 0 {
+		ip, _ := queue.next(now)
+		order = append(order, ip.String())
+	}
+	assert.Equal(t, []string{"2001:db8:1::1", "2001:db8:2::1", "2001:db8:1::2", "2001:db8:1::3"}, order)
+}
+
+func TestPoliteQueue_LimitsPrefixRate(t *testing.T) {
+	queue := newPoliteQueue(48, 10)
+	pushTestingIPs(queue, "2001:db8:1::1", "2001:db8:1::2")
+	now := time.Now()
+	first, _ := queue.next(now)
+	assert.NotNil(t, first)
+	second, wait := queue.next(now)
+	assert.Nil(t, second)
+	assert.Equal(t, 100 * time.Millisecond, wait)
+	second, _ = queue.next(now.Add(wait))
+	assert.NotNil(t, second)
+}
@@ -0,0 +1,169 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/spf13/viper"
+	"net"
+	"strings"
+	"time"
+)
+
+type ResultType int8
+
+//noinspection GoSnakeCaseUsage
+const (
+	ECHO_REPLY ResultType = iota
+	DESTINATION_UNREACHABLE
+	PACKET_TOO_BIG
+	TIME_EXCEEDED
+	TCP_SYN_ACK
+	TCP_RST
+	UDP_REPLY
+	PORT_UNREACHABLE
+	PARAMETER_PROBLEM
+	NEIGHBOR_ADVERTISEMENT
+	ROUTER_ADVERTISEMENT
+)
+
+// The ICMPv6 message type that each result type corresponds to
+var resultICMPTypes = map[ResultType]int{
+	ECHO_REPLY:					129,
+	DESTINATION_UNREACHABLE:	1,
+	PACKET_TOO_BIG:				2,
+	TIME_EXCEEDED:				3,
+	PORT_UNREACHABLE:			1,
+	PARAMETER_PROBLEM:			4,
+	NEIGHBOR_ADVERTISEMENT:		136,
+	ROUTER_ADVERTISEMENT:		134,
+}
+
+// A single response that was received as a result of probing a target. For echo, TCP, and UDP
+// replies Addr and Target are the same address, while for ICMPv6 errors Addr is the router or host
+// that sent the error and Target is the address that was probed. A Port Unreachable error that the
+// target itself sends in answer to a UDP probe, or a Parameter Problem error that it sends about an
+// unrecognized destination option, is a sign that the target is alive rather than an error. For
+// Neighbor Advertisements Target is the address that was solicited and Addr is the address that the
+// advertisement came from, while Router Advertisements are collected without being probed for and
+// have the router as both.
+type Result struct {
+	Type			ResultType
+	Code			int
+	Addr			*net.IP
+	Target			*net.IP
+	Phase			Phase
+	SentAt			time.Time
+	ReceivedAt		time.Time
+	HopLimit		int
+	IfIndex			int
+
+	// The port that a TCP or UDP probe was sent to, for the results of TCP and UDP probes
+	Port			int
+
+	// The hop limit that the probe was sent with, for the results of traces
+	Hop				int
+}
+
+// Whether or not the result is an ICMPv6 error rather than a sign that the target is alive
+func (result *Result) IsError() bool {
+	return result.Type == DESTINATION_UNREACHABLE || result.Type == PACKET_TOO_BIG || result.Type == TIME_EXCEEDED
+}
+
+// Get the ICMPv6 message type of the result (zero for TCP and UDP replies)
+func (result *Result) GetICMPType() int {
+	return resultICMPTypes[result.Type]
+}
+
+func (result *Result) GetRTT() time.Duration {
+	return result.ReceivedAt.Sub(result.SentAt)
+}
+
+// A Prober sends probes to every target read from the targets channel and emits the responses
+// that come back on the returned channel. The returned channel is closed once the scan has
+// finished and the prober has stopped listening for responses.
+type Prober interface {
+
+	// Send probes to the targets, closing the returned channel once done. If the scan is halted then
+	// no more targets are read, so whatever sends them must stop once the returned channel is closed.
+	Probe(targets <-chan *net.IP) (<-chan *Result, error)
+
+	// Get the reason that the most recent scan was stopped early, if it was. Only valid once the
+	// scan's results channel has been closed.
+	Err() error
+}
+
+// The kinds of probes that can be sent to each target
+//noinspection GoSnakeCaseUsage
+const (
+	PROBE_ICMP		= "icmp"
+	PROBE_TCP		= "tcp"
+	PROBE_UDP		= "udp"
+	PROBE_PARAM		= "param"
+	PROBE_BOTH		= "both"
+)
+
+// The kinds of probes that are sent to each target
+type ProbeTypes struct {
+	ICMP			bool		// ICMPv6 echo requests
+	TCP				bool		// TCP SYNs
+	UDP				bool		// UDP service requests
+	ParamProblem	bool		// Echo requests with a Destination Options header that draws a Parameter Problem
+}
+
+// Parse a comma-separated list of probe types ("both" being short for ICMPv6 and TCP)
+func ParseProbeType(toParse string) (*ProbeTypes, error) {
+	toReturn := &ProbeTypes{}
+	for _, field := range strings.Split(toParse, ",") {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case PROBE_ICMP:
+			toReturn.ICMP = true
+		case PROBE_TCP:
+			toReturn.TCP = true
+		case PROBE_UDP:
+			toReturn.UDP = true
+		case PROBE_PARAM:
+			toReturn.ParamProblem = true
+		case PROBE_BOTH:
+			toReturn.ICMP, toReturn.TCP = true, true
+		default:
+			return nil, errors.New(fmt.Sprintf("'%s' is not a valid probe type (expected a comma-separated list of '%s', '%s', '%s', '%s', or '%s').", toParse, PROBE_ICMP, PROBE_TCP, PROBE_UDP, PROBE_PARAM, PROBE_BOTH))
+		}
+	}
+	return toReturn, nil
+}
+
+func NewFromConfig(phase Phase) (Prober, error) {
+	return NewEngine(phase, viper.GetString("PingScanBandwidth"), config.GetPingScanDrainDuration())
+}
+
+// Probe all of the given addresses and return the addresses that responded
+func ProbeAddresses(prober Prober, addrs []*net.IP) ([]*net.IP, error) {
+	targets := make(chan *net.IP)
+	results, err := prober.Probe(targets)
+	if err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(targets)
+		for _, addr := range addrs {
+			select {
+			case targets <- addr:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var toReturn []*net.IP
+	for result := range results {
+		if !result.IsError() {
+			toReturn = append(toReturn, result.Addr)
+		}
+	}
+	if err := prober.Err(); err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,17 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseProbeType(t *testing.T) {
+	types, err := ParseProbeType("BOTH")
+	assert.Nil(t, err)
+	assert.Equal(t, &ProbeTypes{ICMP: true, TCP: true}, types)
+	types, err = ParseProbeType("icmp, udp,param")
+	assert.Nil(t, err)
+	assert.Equal(t, &ProbeTypes{ICMP: true, UDP: true, ParamProblem: true}, types)
+	_, err = ParseProbeType("sctp")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+const ipv6HeaderLength = 40
+
+// Extension headers that may sit between the quoted IPv6 header and the quoted ICMPv6 message
+var extensionHeaders = map[byte]struct{}{
+	0:	{},		// Hop-by-Hop Options
+	43:	{},		// Routing
+	60:	{},		// Destination Options
+}
+
+// A probe that was quoted back to us in the body of an ICMPv6 error message. Echo requests have
+// their echo fields filled in, while TCP and UDP probes have their ports, and either the TCP
+// sequence number or the UDP payload.
+type quotedProbe struct {
+	dst				net.IP
+	protocol		int
+	id				int
+	seq				int
+	payload			[]byte
+	srcPort			int
+	dstPort			int
+	tcpSeq			uint32
+}
+
+// Parse the original datagram field of an ICMPv6 error message, returning the probe that
+// triggered the error if the quoted packet was an echo request, TCP segment, or UDP datagram
+func parseQuotedProbe(data []byte) (*quotedProbe, bool) {
+	if len(data) < ipv6HeaderLength || data[0] >> 4 != 6 {
+		return nil, false
+	}
+	dst := make(net.IP, net.IPv6len)
+	copy(dst, data[24:40])
+
+	// Walk past any extension headers to find the quoted upper-layer message
+	nextHeader := data[6]
+	offset := ipv6HeaderLength
+	for {
+		if _, ok := extensionHeaders[nextHeader]; !ok {
+			break
+		}
+		if len(data) < offset + 2 {
+			return nil, false
+		}
+		nextHeader, offset = data[offset], offset + (int(data[offset + 1]) + 1) * 8
+	}
+	if len(data) < offset + 8 {
+		return nil, false
+	}
+
+	quoted := data[offset:]
+	toReturn := &quotedProbe{dst: dst, protocol: int(nextHeader)}
+	switch nextHeader {
+	case 58:
+		if quoted[0] != 128 {
+			return nil, false
+		}
+		toReturn.id = int(binary.BigEndian.Uint16(quoted[4:6]))
+		toReturn.seq = int(binary.BigEndian.Uint16(quoted[6:8]))
+		toReturn.payload = quoted[8:]
+	case 6:
+		toReturn.srcPort = int(binary.BigEndian.Uint16(quoted[0:2]))
+		toReturn.dstPort = int(binary.BigEndian.Uint16(quoted[2:4]))
+		toReturn.tcpSeq = binary.BigEndian.Uint32(quoted[4:8])
+	case 17:
+		toReturn.srcPort = int(binary.BigEndian.Uint16(quoted[0:2]))
+		toReturn.dstPort = int(binary.BigEndian.Uint16(quoted[2:4]))
+		toReturn.payload = quoted[udpHeaderLength:]
+	default:
+		return nil, false
+	}
+	return toReturn, true
+}
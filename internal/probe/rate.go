@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The bytes that Ethernet adds to every packet on the wire - the frame header, frame check
+// sequence, preamble, and inter-frame gap
+const ethernetOverhead = 14 + 4 + 8 + 12
+
+var bandwidthRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)([KMGkmg]?)(iB|B|b)?$`)
+
+var bandwidthUnits = map[string]float64{
+	"":		1,
+	"K":	1e3,
+	"M":	1e6,
+	"G":	1e9,
+}
+
+// Bandwidths used to be given in base-2 bytes per second, which are still accepted when they have a
+// byte suffix (ex: 20MB or 20MiB)
+var legacyBandwidthUnits = map[string]float64{
+	"":		1,
+	"K":	1 << 10,
+	"M":	1 << 20,
+	"G":	1 << 30,
+}
+
+// Parse a bandwidth given as a number of bits per second followed by K, M, or G (ex: 20M), or as a
+// number of base-2 bytes per second followed by KB, MB, or GB (ex: 2MB)
+func ParseBandwidth(bandwidth string) (float64, error) {
+	match := bandwidthRegex.FindStringSubmatch(bandwidth)
+	if match == nil || (match[2] == "" && match[3] == "iB") {
+		return 0, errors.New(fmt.Sprintf("%s is not a valid bandwidth, expecting a number of bits per second followed by K, M, or G (ex: 10M, 100K) or of bytes per second followed by KB, MB, or GB (ex: 2MB)", bandwidth))
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := strings.ToUpper(match[2])
+	var bitsPerSecond float64
+	if match[3] == "B" || match[3] == "iB" {
+		bitsPerSecond = value * legacyBandwidthUnits[unit] * 8
+	} else {
+		bitsPerSecond = value * bandwidthUnits[unit]
+	}
+	if bitsPerSecond <= 0 {
+		return 0, errors.New(fmt.Sprintf("Bandwidth must be greater than zero (got %s).", bandwidth))
+	}
+	return bitsPerSecond, nil
+}
+
+// Get the number of bytes that an IPv6 packet with the given payload length takes up on the wire
+func getWireSize(payloadLength int) int {
+	return ethernetOverhead + ipv6HeaderLength + payloadLength
+}
+
+// Get the number of probes of the given on-wire size to send per second. If rate is positive then
+// it is used as is, otherwise the rate is worked out from the bandwidth.
+func getProbeRate(bandwidth string, rate float64, wireSize int) (float64, error) {
+	if rate > 0 {
+		return rate, nil
+	}
+	bitsPerSecond, err := ParseBandwidth(bandwidth)
+	if err != nil {
+		return 0, err
+	}
+	return bitsPerSecond / float64(wireSize * 8), nil
+}
@@ -0,0 +1,42 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	for bandwidth, expected := range map[string]float64{
+		"20M":		20e6,
+		"100K":		100e3,
+		"1G":		1e9,
+		"2.5M":		2.5e6,
+		"500":		500,
+		"20m":		20e6,
+		"20Mb":		20e6,
+		"20MB":		20 * (1 << 20) * 8,
+		"1KiB":		1024 * 8,
+		"512B":		512 * 8,
+	} {
+		parsed, err := ParseBandwidth(bandwidth)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, parsed)
+	}
+	for _, bandwidth := range []string{"", "M", "20iB", "20 M", "20X", "20MBps", "0M", "-5M"} {
+		_, err := ParseBandwidth(bandwidth)
+		assert.NotNil(t, err, bandwidth)
+	}
+}
+
+func TestGetProbeRate(t *testing.T) {
+	wireSize := getWireSize(8 + cookiePayloadLength)
+	assert.Equal(t, 102, wireSize)
+	rate, err := getProbeRate("20M", 0, wireSize)
+	assert.Nil(t, err)
+	assert.InDelta(t, 20e6 / (102 * 8), rate, 0.001)
+	rate, err = getProbeRate("20M", 5000, wireSize)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(5000), rate)
+	_, err = getProbeRate("fast", 0, wireSize)
+	assert.NotNil(t, err)
+}
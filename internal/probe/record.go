@@ -0,0 +1,140 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// The stage of the discovery process that a probe was sent as part of
+type Phase string
+
+//noinspection GoSnakeCaseUsage
+const (
+	PHASE_GENERATE			Phase = "gen"
+	PHASE_NYBBLE_FANOUT		Phase = "nybble_fanout"
+	PHASE_SLASH64_FANOUT	Phase = "slash64_fanout"
+	PHASE_ALIAS				Phase = "alias"
+	PHASE_TRACE				Phase = "trace"
+	PHASE_LOCAL				Phase = "local"
+)
+
+var resultTypeNames = map[ResultType]string{
+	ECHO_REPLY:					"echo_reply",
+	DESTINATION_UNREACHABLE:	"destination_unreachable",
+	PACKET_TOO_BIG:				"packet_too_big",
+	TIME_EXCEEDED:				"time_exceeded",
+	TCP_SYN_ACK:				"tcp_syn_ack",
+	TCP_RST:					"tcp_rst",
+	UDP_REPLY:					"udp_reply",
+	PORT_UNREACHABLE:			"port_unreachable",
+	PARAMETER_PROBLEM:			"parameter_problem",
+	NEIGHBOR_ADVERTISEMENT:		"neighbor_advertisement",
+	ROUTER_ADVERTISEMENT:		"router_advertisement",
+}
+
+// A Record is the on-disk form of a Result. Results files contain one JSON-encoded record per line.
+type Record struct {
+	Type			string				`json:"type"`
+	ICMPType		int					`json:"icmp_type"`
+	ICMPCode		int					`json:"icmp_code"`
+	Addr			string				`json:"addr"`
+	Target			string				`json:"target"`
+	Phase			Phase				`json:"phase"`
+	SentAt			time.Time			`json:"sent_at"`
+	ReceivedAt		time.Time			`json:"received_at"`
+	RTT				time.Duration		`json:"rtt_ns"`
+	HopLimit		int					`json:"hop_limit"`
+	IfIndex			int					`json:"if_index"`
+	Port			int					`json:"port"`
+}
+
+func NewRecord(result *Result) *Record {
+	return &Record{
+		Type:			resultTypeNames[result.Type],
+		ICMPType:		result.GetICMPType(),
+		ICMPCode:		result.Code,
+		Addr:			result.Addr.String(),
+		Target:			result.Target.String(),
+		Phase:			result.Phase,
+		SentAt:			result.SentAt,
+		ReceivedAt:		result.ReceivedAt,
+		RTT:			result.GetRTT(),
+		HopLimit:		result.HopLimit,
+		IfIndex:		result.IfIndex,
+		Port:			result.Port,
+	}
+}
+
+func (record *Record) IsError() bool {
+	return record.Type == resultTypeNames[DESTINATION_UNREACHABLE] || record.Type == resultTypeNames[PACKET_TOO_BIG] || record.Type == resultTypeNames[TIME_EXCEEDED]
+}
+
+func (record *Record) GetAddr() (*net.IP, error) {
+	addr := net.ParseIP(record.Addr)
+	if addr == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid address in record: '%s'", record.Addr))
+	}
+	return &addr, nil
+}
+
+// Write a result to w as a single line record
+func WriteRecord(w io.Writer, result *Result) error {
+	encoded, err := json.Marshal(NewRecord(result))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", encoded)
+	return err
+}
+
+func ReadRecordsFromFile(filePath string) ([]*Record, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var toReturn []*Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Results files written before records were introduced hold one echo replying address per line
+			addr := net.ParseIP(scanner.Text())
+			if addr == nil {
+				return nil, errors.New(fmt.Sprintf("Error thrown when parsing record in file '%s': %s", filePath, err))
+			}
+			record = Record{Type: resultTypeNames[ECHO_REPLY], Addr: addr.String(), Target: addr.String()}
+		}
+		toReturn = append(toReturn, &record)
+	}
+	return toReturn, scanner.Err()
+}
+
+// Read the addresses that responded with echo replies from a results file
+func ReadLiveAddrsFromRecordFile(filePath string) ([]*net.IP, error) {
+	records, err := ReadRecordsFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var toReturn []*net.IP
+	for _, record := range records {
+		if record.IsError() {
+			continue
+		}
+		addr, err := record.GetAddr()
+		if err != nil {
+			return nil, err
+		}
+		toReturn = append(toReturn, addr)
+	}
+	return toReturn, nil
+}
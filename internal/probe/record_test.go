@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadLiveAddrsFromRecordFile(t *testing.T) {
+	file, _ := ioutil.TempFile("", "records")
+	defer os.Remove(file.Name())
+	live := net.ParseIP("2001:db8::1")
+	router := net.ParseIP("2001:db8::ffff")
+	target := net.ParseIP("2001:db8:1::1")
+	sentAt := time.Now()
+	WriteRecord(file, &Result{Type: ECHO_REPLY, Addr: &live, Target: &live, Phase: PHASE_GENERATE, SentAt: sentAt, ReceivedAt: sentAt.Add(time.Millisecond)})
+	WriteRecord(file, &Result{Type: DESTINATION_UNREACHABLE, Code: 3, Addr: &router, Target: &target, Phase: PHASE_GENERATE})
+	file.Close()
+
+	records, err := ReadRecordsFromFile(file.Name())
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, time.Millisecond, records[0].RTT)
+	assert.Equal(t, 1, records[1].ICMPType)
+	assert.Equal(t, 3, records[1].ICMPCode)
+
+	addrs, err := ReadLiveAddrsFromRecordFile(file.Name())
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 1)
+	assert.Equal(t, live.String(), addrs[0].String())
+}
+
+func TestReadLiveAddrsFromRecordFile_PlainAddresses(t *testing.T) {
+	file, _ := ioutil.TempFile("", "records")
+	defer os.Remove(file.Name())
+	file.WriteString("2001:db8::1\n2001:db8::2\n")
+	file.Close()
+
+	addrs, err := ReadLiveAddrsFromRecordFile(file.Name())
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 2)
+	assert.Equal(t, "2001:db8::2", addrs[1].String())
+
+	ioutil.WriteFile(file.Name(), []byte("not an address\n"), 0644)
+	_, err = ReadLiveAddrsFromRecordFile(file.Name())
+	assert.NotNil(t, err)
+}
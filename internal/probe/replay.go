@@ -0,0 +1,226 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Link-layer header types that captures can be replayed from
+const (
+	pcapLinkTypeEthernet	= 1
+	pcapLinkTypeLinuxSLL	= 113
+	pcapLinkTypeIPv6		= 229
+)
+
+const pcapngMagic = 0x0a0d0d0a
+
+// Call handle with the capture time and IPv6 packet of each IPv6 packet in the pcap file at
+// filePath. Packets of other protocols are skipped.
+func readCapture(filePath string, handle func(at time.Time, packet []byte)) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	// The byte order and timestamp resolution are given by the magic number
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return errors.New(fmt.Sprintf("Could not read pcap header from '%s': %s", filePath, err))
+	}
+	var order binary.ByteOrder
+	var nanos bool
+	switch {
+	case binary.LittleEndian.Uint32(header[0:4]) == pcapMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[0:4]) == pcapMagic:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[0:4]) == 0xa1b23c4d:
+		order, nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[0:4]) == 0xa1b23c4d:
+		order, nanos = binary.BigEndian, true
+	case binary.BigEndian.Uint32(header[0:4]) == pcapngMagic:
+		return errors.New(fmt.Sprintf("'%s' is a pcapng file. Please convert it to pcap first (i.e. 'editcap -F pcap').", filePath))
+	default:
+		return errors.New(fmt.Sprintf("'%s' is not a pcap file.", filePath))
+	}
+	linkType := order.Uint32(header[20:24])
+	switch linkType {
+	case pcapLinkTypeRaw, pcapLinkTypeIPv6, pcapLinkTypeEthernet, pcapLinkTypeLinuxSLL:
+	default:
+		return errors.New(fmt.Sprintf("Captures with link type %d are not supported.", linkType))
+	}
+
+	recordHeader := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(reader, recordHeader); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.New(fmt.Sprintf("Could not read packet header from '%s': %s", filePath, err))
+		}
+		fraction := int64(order.Uint32(recordHeader[4:8]))
+		if !nanos {
+			fraction *= 1000
+		}
+		at := time.Unix(int64(order.Uint32(recordHeader[0:4])), fraction)
+		data := make([]byte, order.Uint32(recordHeader[8:12]))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return errors.New(fmt.Sprintf("Could not read packet from '%s': %s", filePath, err))
+		}
+		if packet, ok := stripLinkLayer(linkType, data); ok {
+			handle(at, packet)
+		}
+	}
+}
+
+// Get the IPv6 packet carried in a captured frame
+func stripLinkLayer(linkType uint32, data []byte) ([]byte, bool) {
+	var etherType uint16
+	switch linkType {
+	case pcapLinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:14]), data[14:]
+
+		// Skip past any VLAN tags
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType, data = binary.BigEndian.Uint16(data[2:4]), data[4:]
+		}
+	case pcapLinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	default:
+		etherType = 0x86dd
+	}
+	if etherType != 0x86dd || len(data) < ipv6HeaderLength || data[0] >> 4 != 6 {
+		return nil, false
+	}
+	return data, true
+}
+
+// Get the addresses, hop limit, and ICMPv6 message of an IPv6 packet, if it carries one
+func parseICMPv6Packet(packet []byte) (net.IP, net.IP, int, []byte, bool) {
+	nextHeader := packet[6]
+	offset := ipv6HeaderLength
+	for {
+		if _, ok := extensionHeaders[nextHeader]; !ok {
+			break
+		}
+		if len(packet) < offset + 2 {
+			return nil, nil, 0, nil, false
+		}
+		nextHeader, offset = packet[offset], offset + (int(packet[offset + 1]) + 1) * 8
+	}
+	end := ipv6HeaderLength + int(binary.BigEndian.Uint16(packet[4:6]))
+	if nextHeader != 58 || offset > end || end > len(packet) {
+		return nil, nil, 0, nil, false
+	}
+	src, dst := make(net.IP, net.IPv6len), make(net.IP, net.IPv6len)
+	copy(src, packet[8:24])
+	copy(dst, packet[24:40])
+	return src, dst, int(packet[7]), packet[offset:end], true
+}
+
+func getProbeKey(target net.IP, id int, payload []byte) string {
+	return fmt.Sprintf("%s-%d-%x", target, id, payload)
+}
+
+// Rebuild the results of a scan from a pcap file of its traffic, such as one written with
+// PacketCaptureEnabled. The secret that the probes were signed with is long gone, so if the
+// capture holds the echo requests that were sent then only the responses to those requests are
+// kept (and timed from when they were sent). Otherwise every echo reply and error message that
+// quotes an echo request is kept.
+func ReadResultsFromCapture(filePath string, phase Phase) ([]*Result, error) {
+
+	// Find the probes that were sent first, as their replies may have been captured before them
+	sent := make(map[string]time.Time)
+	err := readCapture(filePath, func(at time.Time, packet []byte) {
+		_, dst, _, message, ok := parseICMPv6Packet(packet)
+		if !ok {
+			return
+		}
+		msg, err := icmp.ParseMessage(58, message)
+		if err != nil || msg.Type != ipv6.ICMPTypeEchoRequest {
+			return
+		}
+		if echo, ok := msg.Body.(*icmp.Echo); ok {
+			sent[getProbeKey(dst, echo.ID, echo.Data)] = at
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sent) == 0 {
+		logging.Warnf("No echo requests found in '%s'. Responses can't be checked against the probes that were sent.", filePath)
+	}
+
+	// Then match up the responses to them
+	var toReturn []*Result
+	seen := make(map[string]struct{})
+	unmatchedCount, duplicateCount := 0, 0
+	err = readCapture(filePath, func(at time.Time, packet []byte) {
+		src, _, hopLimit, message, ok := parseICMPv6Packet(packet)
+		if !ok {
+			return
+		}
+		msg, err := icmp.ParseMessage(58, message)
+		if err != nil {
+			return
+		}
+		result, ok := parseResult(msg, src)
+		if !ok || result.protocol != 58 {
+			return
+		}
+		if len(sent) > 0 {
+			sentAt, ok := sent[getProbeKey(*result.Target, result.id, result.payload)]
+			if !ok {
+				unmatchedCount++
+				return
+			}
+			result.SentAt = sentAt
+		} else if len(result.payload) == cookiePayloadLength {
+			result.SentAt = time.Unix(0, int64(binary.BigEndian.Uint64(result.payload[:8])))
+		}
+
+		// Only report the first response of each type for each target
+		key := fmt.Sprintf("%d-%s", result.Type, result.Target)
+		if _, ok := seen[key]; ok {
+			duplicateCount++
+			return
+		}
+		seen[key] = struct{}{}
+
+		result.Phase = phase
+		result.ReceivedAt = at
+		result.HopLimit = hopLimit
+		toReturn = append(toReturn, result.Result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.Infof(
+		"Read %d responses to %d probes from '%s' (discarded %d that didn't answer a captured probe and %d duplicates).",
+		len(toReturn),
+		len(sent),
+		filePath,
+		unmatchedCount,
+		duplicateCount,
+	)
+	return toReturn, nil
+}
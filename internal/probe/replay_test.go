@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStripLinkLayer(t *testing.T) {
+	packet := buildIPv6Packet(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 64, 58, []byte{129, 0, 0, 0, 0, 0, 0, 0})
+
+	stripped, ok := stripLinkLayer(pcapLinkTypeRaw, packet)
+	assert.True(t, ok)
+	assert.Equal(t, packet, stripped)
+
+	ethernet := append(make([]byte, 12), 0x81, 0x00, 0x00, 0x05, 0x86, 0xdd)
+	stripped, ok = stripLinkLayer(pcapLinkTypeEthernet, append(ethernet, packet...))
+	assert.True(t, ok)
+	assert.Equal(t, packet, stripped)
+
+	sll := append(make([]byte, 14), 0x86, 0xdd)
+	stripped, ok = stripLinkLayer(pcapLinkTypeLinuxSLL, append(sll, packet...))
+	assert.True(t, ok)
+	assert.Equal(t, packet, stripped)
+
+	ipv4 := append(make([]byte, 12), 0x08, 0x00)
+	_, ok = stripLinkLayer(pcapLinkTypeEthernet, append(ipv4, packet...))
+	assert.False(t, ok)
+}
+
+func TestReadResultsFromCapture_WithoutRequests(t *testing.T) {
+	config.InitConfig()
+	file, _ := ioutil.TempFile("", "replay")
+	file.Close()
+	defer os.Remove(file.Name())
+	capture, _ := NewCaptureWriter(file.Name())
+
+	// Replies are timed from the send time in their payload when their probes weren't captured
+	jar, _ := newCookieJar()
+	host := net.ParseIP("2001:db8::1")
+	local := net.ParseIP("2001:db8:ffff::1")
+	sentAt := time.Unix(1500000000, 0)
+	receivedAt := sentAt.Add(10 * time.Millisecond)
+	id, payload := jar.sign(host, sentAt)
+	reply, _ := (&icmp.Message{Type: ipv6.ICMPTypeEchoReply, Body: &icmp.Echo{ID: id, Seq: 1, Data: payload}}).Marshal(icmp.IPv6PseudoHeader(host, local))
+	capture.WritePacket(receivedAt, buildIPv6Packet(host, local, 60, 58, reply))
+	capture.WritePacket(receivedAt, buildIPv6Packet(host, local, 60, 58, reply))
+	capture.Close()
+
+	results, err := ReadResultsFromCapture(file.Name(), PHASE_NYBBLE_FANOUT)
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, ECHO_REPLY, results[0].Type)
+	assert.Equal(t, "2001:db8::1", results[0].Addr.String())
+	assert.Equal(t, PHASE_NYBBLE_FANOUT, results[0].Phase)
+	assert.Equal(t, 60, results[0].HopLimit)
+	assert.Equal(t, 10 * time.Millisecond, results[0].GetRTT())
+}
+
+func TestReadResultsFromCapture_NotPcap(t *testing.T) {
+	file, _ := ioutil.TempFile("", "replay")
+	file.Write(make([]byte, 64))
+	file.Close()
+	defer os.Remove(file.Name())
+	_, err := ReadResultsFromCapture(file.Name(), PHASE_GENERATE)
+	assert.NotNil(t, err)
+}
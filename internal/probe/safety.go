@@ -0,0 +1,197 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var probeHaltCount = metrics.NewCounter()
+
+func init() {
+	metrics.Register("probe.halts.count", probeHaltCount)
+}
+
+// ICMPv6 Destination Unreachable codes with which a network tells us that it is refusing our traffic
+var objectionCodes = map[int]string{
+	1:	"Administratively Prohibited",
+	5:	"Source Address Failed Ingress/Egress Policy",
+	6:	"Reject Route",
+}
+
+// HaltError is returned for a scan that was stopped because the network was objecting to it
+type HaltError struct {
+	Reason			string
+}
+
+func (err *HaltError) Error() string {
+	return fmt.Sprintf("Scan halted for safety: %s", err.Reason)
+}
+
+// A safetyMonitor watches a scan for signs that the networks being scanned are objecting to it -
+// a high ratio of objections and refused sends to probes, bursts of objections from a single
+// prefix, or a run of refused sends - and trips once any of the configured thresholds are crossed.
+// A threshold of zero is never crossed. Other ICMPv6 errors, such as the Address Unreachable errors
+// that last-hop routers send for most addresses that don't exist, don't count against a scan.
+type safetyMonitor struct {
+	lock				sync.Mutex
+	maxErrorRatio		float64
+	maxObjections		int
+	maxSendFailures		uint64
+	minSamples			uint64
+	prefixMask			net.IPMask
+	objections			map[[16]byte]int
+	sendFailures		uint64
+	objectionTotal		uint64
+	failureTotal		uint64
+	lastSent			uint64
+	lastProblems		uint64
+	reason				string
+	tripped				chan struct{}
+}
+
+func newSafetyMonitor(prefixLength int) *safetyMonitor {
+	return &safetyMonitor{
+		maxErrorRatio:		viper.GetFloat64("PingScanHaltErrorRatio"),
+		maxObjections:		viper.GetInt("PingScanHaltPrefixObjections"),
+		maxSendFailures:	uint64(viper.GetInt("PingScanHaltSendFailures")),
+		minSamples:			uint64(viper.GetInt("PingScanHaltMinSamples")),
+		prefixMask:			net.CIDRMask(prefixLength, 128),
+		objections:			make(map[[16]byte]int),
+		tripped:			make(chan struct{}),
+	}
+}
+
+func (monitor *safetyMonitor) trip(reason string) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	if monitor.reason != "" {
+		return
+	}
+	monitor.reason = reason
+	close(monitor.tripped)
+}
+
+// Get the reason that the monitor tripped, or an empty string if it hasn't
+func (monitor *safetyMonitor) getReason() string {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	return monitor.reason
+}
+
+// Get the number of objections and refused sends seen so far in the scan
+func (monitor *safetyMonitor) getProblemCount() uint64 {
+	return atomic.LoadUint64(&monitor.objectionTotal) + atomic.LoadUint64(&monitor.failureTotal)
+}
+
+// Clear the monitor so that it can trip again, starting its counts over from the given number of
+// probes sent
+func (monitor *safetyMonitor) reset(sent uint64) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	monitor.objections = make(map[[16]byte]int)
+	atomic.StoreUint64(&monitor.sendFailures, 0)
+	monitor.lastSent, monitor.lastProblems = sent, monitor.getProblemCount()
+	monitor.reason = ""
+	monitor.tripped = make(chan struct{})
+}
+
+func (monitor *safetyMonitor) getTripped() <-chan struct{} {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	return monitor.tripped
+}
+
+// Record a response to a probe, tripping if its prefix has objected too many times this interval
+func (monitor *safetyMonitor) observe(result *Result) {
+	if result.Type != DESTINATION_UNREACHABLE {
+		return
+	}
+	name, ok := objectionCodes[result.Code]
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&monitor.objectionTotal, 1)
+	if monitor.maxObjections <= 0 {
+		return
+	}
+	var key [16]byte
+	copy(key[:], result.Target.To16().Mask(monitor.prefixMask))
+	monitor.lock.Lock()
+	monitor.objections[key]++
+	count := monitor.objections[key]
+	monitor.lock.Unlock()
+	if count > monitor.maxObjections {
+		prefix := net.IPNet{IP: net.IP(key[:]), Mask: monitor.prefixMask}
+		monitor.trip(fmt.Sprintf("received more than %d %s errors for probes to %s", monitor.maxObjections, name, prefix.String()))
+	}
+}
+
+// Record the outcome of an attempt to send a probe, tripping after too many failures in a row
+func (monitor *safetyMonitor) sendResult(ok bool) {
+	if ok {
+		atomic.StoreUint64(&monitor.sendFailures, 0)
+		return
+	}
+	atomic.AddUint64(&monitor.failureTotal, 1)
+	failures := atomic.AddUint64(&monitor.sendFailures, 1)
+	if monitor.maxSendFailures > 0 && failures >= monitor.maxSendFailures {
+		monitor.trip(fmt.Sprintf("%d consecutive attempts to send probes were refused", failures))
+	}
+}
+
+// Check the ratio of objections and refused sends to probes sent since the last interval given the
+// number of probes sent so far in the scan, and start a new interval
+func (monitor *safetyMonitor) interval(sent uint64) {
+	monitor.lock.Lock()
+	problems := monitor.getProblemCount()
+	sentDelta, problemDelta := sent - monitor.lastSent, problems - monitor.lastProblems
+	enough := sentDelta >= monitor.minSamples && sentDelta > 0
+	if enough {
+		monitor.lastSent, monitor.lastProblems = sent, problems
+	}
+	monitor.objections = make(map[[16]byte]int)
+	monitor.lock.Unlock()
+	if !enough || monitor.maxErrorRatio <= 0 {
+		return
+	}
+	if ratio := float64(problemDelta) / float64(sentDelta); ratio > monitor.maxErrorRatio {
+		monitor.trip(fmt.Sprintf("%.0f%% of %d probes were refused or drew objections (limit is %.0f%%)", ratio * 100, sentDelta, monitor.maxErrorRatio * 100))
+	}
+}
+
+// Periodically check the scan's objection ratio until stop is closed
+func (engine *Engine) watchSafety(monitor *safetyMonitor, stats *sendStats, stop <-chan struct{}) {
+	ticker := time.NewTicker(engine.haltInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			monitor.interval(atomic.LoadUint64(&stats.sent))
+		}
+	}
+}
+
+// Handle the safety monitor having tripped, pausing the scan the first time if a pause is
+// configured. Returns the error that the scan should be stopped with, if any.
+func (engine *Engine) handleHalt(monitor *safetyMonitor, stats *sendStats, paused *bool) error {
+	reason := monitor.getReason()
+	probeHaltCount.Inc(1)
+	if engine.haltPause > 0 && !*paused {
+		*paused = true
+		logging.Warnf("Pausing scan for %s as %s.", engine.haltPause, reason)
+		time.Sleep(engine.haltPause)
+		monitor.reset(atomic.LoadUint64(&stats.sent))
+		logging.Warnf("Resuming scan. It will be stopped if the network objects again.")
+		return nil
+	}
+	logging.Warnf("Stopping scan as %s.", reason)
+	return &HaltError{Reason: reason}
+}
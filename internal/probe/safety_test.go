@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func newTestSafetyMonitor() *safetyMonitor {
+	return &safetyMonitor{
+		maxErrorRatio:		0.5,
+		maxObjections:		3,
+		maxSendFailures:	5,
+		minSamples:			100,
+		prefixMask:			net.CIDRMask(48, 128),
+		objections:			make(map[[16]byte]int),
+		tripped:			make(chan struct{}),
+	}
+}
+
+func isTripped(monitor *safetyMonitor) bool {
+	select {
+	case <-monitor.getTripped():
+		return true
+	default:
+		return false
+	}
+}
+
+func newUnreachable(target string, code int) *Result {
+	targetAddr := net.ParseIP(target)
+	return &Result{
+		Type:		DESTINATION_UNREACHABLE,
+		Code:		code,
+		Target:		&targetAddr,
+	}
+}
+
+func TestSafetyMonitor_TripsOnObjectionsFromOnePrefix(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	for i := 0; i < 3; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 1))
+		monitor.observe(newUnreachable("2001:db8:2::1", 6))
+	}
+	monitor.observe(newUnreachable("2001:db8:1::2", 3))
+	assert.False(t, isTripped(monitor))
+	monitor.observe(newUnreachable("2001:db8:1::3", 1))
+	assert.True(t, isTripped(monitor))
+	assert.Contains(t, monitor.getReason(), "2001:db8:1::/48")
+}
+
+func TestSafetyMonitor_ObjectionsAreCountedPerInterval(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	for i := 0; i < 3; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 1))
+	}
+	monitor.interval(0)
+	monitor.observe(newUnreachable("2001:db8:1::1", 1))
+	assert.False(t, isTripped(monitor))
+}
+
+func TestSafetyMonitor_TripsOnConsecutiveSendFailures(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	for i := 0; i < 4; i++ {
+		monitor.sendResult(false)
+	}
+	monitor.sendResult(true)
+	for i := 0; i < 4; i++ {
+		monitor.sendResult(false)
+	}
+	assert.False(t, isTripped(monitor))
+	monitor.sendResult(false)
+	assert.True(t, isTripped(monitor))
+}
+
+func TestSafetyMonitor_TripsOnObjectionRatio(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	monitor.maxObjections = 0
+	for i := 0; i < 50; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 1))
+	}
+	monitor.interval(50)
+	assert.False(t, isTripped(monitor))
+	for i := 0; i < 50; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 5))
+	}
+	monitor.interval(200)
+	assert.False(t, isTripped(monitor))
+	for i := 0; i < 100; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 6))
+	}
+	for i := 0; i < 4; i++ {
+		monitor.sendResult(false)
+	}
+	monitor.interval(400)
+	assert.True(t, isTripped(monitor))
+}
+
+func TestSafetyMonitor_IgnoresAddressUnreachableInRatio(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	for i := 0; i < 1000; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 3))
+	}
+	monitor.interval(1000)
+	assert.False(t, isTripped(monitor))
+}
+
+func TestSafetyMonitor_ResetAllowsTrippingAgain(t *testing.T) {
+	monitor := newTestSafetyMonitor()
+	monitor.trip("first")
+	assert.True(t, isTripped(monitor))
+	for i := 0; i < 1000; i++ {
+		monitor.observe(newUnreachable("2001:db8:1::1", 1))
+	}
+	monitor.reset(1000)
+	assert.False(t, isTripped(monitor))
+	assert.Equal(t, "", monitor.getReason())
+	monitor.interval(1100)
+	assert.False(t, isTripped(monitor))
+	monitor.trip("second")
+	assert.Equal(t, "second", monitor.getReason())
+}
@@ -0,0 +1,271 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Conn that can send several packets with a single system call (sendmmsg on Linux)
+type BatchConn interface {
+	Conn
+	WriteBatch(ms []ipv6.Message, flags int) (int, error)
+}
+
+// The hop limit that probes are sent with outside of traces
+const defaultHopLimit = 255
+
+var errNothingSent = errors.New("no packets were sent")
+
+// A group of targets that are signed, marshalled, and sent together
+type probeBatch struct {
+	targets			[]*net.IP
+	seq				uint16
+}
+
+// The counts kept by the sender goroutines of a single scan
+type sendStats struct {
+	sent			uint64
+	abandoned		uint64
+	failed			uint64
+	excluded		uint64
+	outstanding		int64
+}
+
+// Marshal an echo request once so that the packets for each target only need their echo fields
+// filled in. The ICMPv6 checksum is left for the kernel to compute.
+func newEchoTemplate() ([]byte, error) {
+	ping := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Code: 0,
+		Body: &icmp.Echo{Data: make([]byte, cookiePayloadLength)},
+	}
+	return ping.Marshal(nil)
+}
+
+// Sign, marshal, and send each batch read from batches until the channel is closed. Each target is
+// sent one echo request per control message (i.e. one per hop limit when tracing), one TCP SYN per
+// TCP port, and one UDP probe per UDP port.
+func (engine *Engine) runSender(conns *probeConns, jar *cookieJar, pending *pendingSet, template []byte, wcms []*ipv6.ControlMessage, batches <-chan *probeBatch, stats *sendStats, monitor *safetyMonitor, wg *sync.WaitGroup) {
+	defer wg.Done()
+	oobs := make([][]byte, len(wcms))
+	for i, wcm := range wcms {
+		oobs[i] = wcm.Marshal()
+	}
+	portWcm := &ipv6.ControlMessage{HopLimit: defaultHopLimit, Src: engine.source, IfIndex: engine.ifIndex}
+	portOob := portWcm.Marshal()
+	for batch := range batches {
+		sentAt := time.Now()
+		sent := make([]bool, len(batch.targets))
+		sentCount, probeCount := 0, 0
+
+		// Build every echo request in the batch from the template in a single allocation
+		if len(wcms) > 0 {
+			perTarget := len(wcms)
+			count := len(batch.targets) * perTarget
+			buf := make([]byte, count * len(template))
+			msgs := make([]ipv6.Message, count)
+			cms := make([]*ipv6.ControlMessage, count)
+			owners := make([]int, count)
+			for i, ip := range batch.targets {
+				echoID, echoData := jar.sign(*ip, sentAt)
+				for j := range wcms {
+					k := i * perTarget + j
+					req := buf[k * len(template):(k + 1) * len(template)]
+					copy(req, template)
+					binary.BigEndian.PutUint16(req[4:6], uint16(echoID))
+					if engine.tracing {
+						binary.BigEndian.PutUint16(req[6:8], uint16(wcms[j].HopLimit))
+					} else {
+						binary.BigEndian.PutUint16(req[6:8], batch.seq + uint16(i))
+					}
+					copy(req[8:], echoData)
+					msgs[k] = ipv6.Message{
+						Buffers:	[][]byte{req},
+						OOB:		oobs[j],
+						Addr:		&net.IPAddr{IP: *ip},
+					}
+					cms[k], owners[k] = wcms[j], i
+				}
+			}
+			sentCount += engine.sendMessages(conns.icmp, msgs, cms, owners, sent, stats, monitor)
+			probeCount += count
+		}
+
+		// Parameter Problem probes are echo requests sent over the connection that adds the
+		// unrecognized destination option to them, and are signed the same way
+		if engine.paramProblem {
+			count := len(batch.targets)
+			buf := make([]byte, count * len(template))
+			msgs := make([]ipv6.Message, count)
+			cms := make([]*ipv6.ControlMessage, count)
+			owners := make([]int, count)
+			for i, ip := range batch.targets {
+				echoID, echoData := jar.sign(*ip, sentAt)
+				req := buf[i * len(template):(i + 1) * len(template)]
+				copy(req, template)
+				binary.BigEndian.PutUint16(req[4:6], uint16(echoID))
+				binary.BigEndian.PutUint16(req[6:8], batch.seq + uint16(i))
+				copy(req[8:], echoData)
+				msgs[i] = ipv6.Message{
+					Buffers:	[][]byte{req},
+					OOB:		portOob,
+					Addr:		&net.IPAddr{IP: *ip},
+				}
+				cms[i], owners[i] = portWcm, i
+			}
+			sentCount += engine.sendMessages(conns.options, msgs, cms, owners, sent, stats, monitor)
+			probeCount += count
+		}
+
+		// TCP SYNs carry their cookie in the sequence number and the time that they were sent in the
+		// source port
+		if len(engine.tcpPorts) > 0 {
+			perTarget := len(engine.tcpPorts)
+			count := len(batch.targets) * perTarget
+			buf := make([]byte, count * tcpHeaderLength)
+			msgs := make([]ipv6.Message, count)
+			cms := make([]*ipv6.ControlMessage, count)
+			owners := make([]int, count)
+			for i, ip := range batch.targets {
+				for j, port := range engine.tcpPorts {
+					k := i * perTarget + j
+					req := buf[k * tcpHeaderLength:(k + 1) * tcpHeaderLength]
+					srcPort, seq := jar.signPort(*ip, port, sentAt)
+					putTCPSyn(req, srcPort, port, seq)
+					msgs[k] = ipv6.Message{
+						Buffers:	[][]byte{req},
+						OOB:		portOob,
+						Addr:		&net.IPAddr{IP: *ip},
+					}
+					cms[k], owners[k] = portWcm, i
+				}
+			}
+			sentCount += engine.sendMessages(conns.tcp, msgs, cms, owners, sent, stats, monitor)
+			probeCount += count
+		}
+
+		// UDP probes carry their cookie in a field of the service request that the reply echoes, and
+		// the time that they were sent in the source port
+		if len(engine.udpPorts) > 0 {
+			perTarget := len(engine.udpPorts)
+			count := len(batch.targets) * perTarget
+			msgs := make([]ipv6.Message, count)
+			cms := make([]*ipv6.ControlMessage, count)
+			owners := make([]int, count)
+			for i, ip := range batch.targets {
+				for j, port := range engine.udpPorts {
+					k := i * perTarget + j
+					srcPort, cookie := jar.signPort(*ip, port, sentAt)
+					msgs[k] = ipv6.Message{
+						Buffers:	[][]byte{newUDPDatagram(srcPort, port, udpServices[port].request(cookie))},
+						OOB:		portOob,
+						Addr:		&net.IPAddr{IP: *ip},
+					}
+					cms[k], owners[k] = portWcm, i
+				}
+			}
+			sentCount += engine.sendMessages(conns.udp, msgs, cms, owners, sent, stats, monitor)
+			probeCount += count
+		}
+
+		// A target counts as sent if any of its probes were
+		if engine.retryCount > 0 {
+			for i, ip := range batch.targets {
+				if sent[i] {
+					pending.sent(ip, sentAt)
+				}
+			}
+		}
+		atomic.AddUint64(&stats.sent, uint64(sentCount))
+		atomic.AddUint64(&stats.abandoned, uint64(probeCount - sentCount))
+		probeSentMeter.Mark(int64(sentCount))
+		probeSentBytesCount.Inc(int64(sentCount * engine.wireSize))
+		atomic.AddInt64(&stats.outstanding, -1)
+	}
+}
+
+// Send packets over the connection (in batches if it supports them), marking the targets that the
+// packets belong to (given by their indexes in owners) as sent. Returns the number of packets sent.
+func (engine *Engine) sendMessages(conn Conn, msgs []ipv6.Message, cms []*ipv6.ControlMessage, owners []int, sent []bool, stats *sendStats, monitor *safetyMonitor) int {
+	if batchConn, ok := conn.(BatchConn); ok {
+		count := engine.writeBatchWithBackoff(batchConn, msgs, stats, monitor)
+		for _, owner := range owners[:count] {
+			sent[owner] = true
+		}
+		return count
+	}
+	count := 0
+	for k, msg := range msgs {
+		if engine.writeWithBackoff(conn, msg.Buffers[0], cms[k], msg.Addr, stats, monitor) {
+			sent[owners[k]] = true
+			count++
+		}
+	}
+	return count
+}
+
+// Send a batch of packets, backing off exponentially and trying again if the network stack refuses
+// to send some of them (i.e. due to network buffer backpressure). Returns the number of packets
+// sent - any after that are given up on.
+func (engine *Engine) writeBatchWithBackoff(conn BatchConn, msgs []ipv6.Message, stats *sendStats, monitor *safetyMonitor) int {
+	sent := 0
+	backoff := engine.sendBackoff
+	for attempt := 0; sent < len(msgs); {
+		n, err := conn.WriteBatch(msgs[sent:], 0)
+		if n > 0 {
+			sent += n
+			attempt = 0
+			backoff = engine.sendBackoff
+			monitor.sendResult(true)
+		}
+		if err == nil {
+			if n > 0 {
+				continue
+			}
+			// Nothing was sent but nothing went wrong either, which counts as a failed attempt so that
+			// the batch isn't retried forever
+			err = errNothingSent
+		}
+		probeSendFailedCount.Inc(1)
+		atomic.AddUint64(&stats.failed, 1)
+		monitor.sendResult(false)
+		if attempt >= engine.sendRetryCount {
+			probeSendAbandonedCount.Inc(int64(len(msgs) - sent))
+			logging.Debugf("Giving up on sending %d probes after %d attempts (%s)", len(msgs) - sent, attempt + 1, err)
+			break
+		}
+		attempt++
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return sent
+}
+
+// Write a packet to the connection, backing off exponentially and trying again if the write fails
+// (i.e. due to network buffer backpressure). Returns false if the packet was given up on.
+func (engine *Engine) writeWithBackoff(conn Conn, req []byte, wcm *ipv6.ControlMessage, dst net.Addr, stats *sendStats, monitor *safetyMonitor) bool {
+	backoff := engine.sendBackoff
+	for attempt := 0; ; attempt++ {
+		_, err := conn.WriteTo(req, wcm, dst)
+		monitor.sendResult(err == nil)
+		if err == nil {
+			return true
+		}
+		probeSendFailedCount.Inc(1)
+		atomic.AddUint64(&stats.failed, 1)
+		if attempt >= engine.sendRetryCount {
+			probeSendAbandonedCount.Inc(1)
+			logging.Debugf("Giving up on sending probe to %s after %d attempts (%s)", dst, attempt + 1, err)
+			return false
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,47 @@
+package probe
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+	"testing"
+)
+
+// A BatchConn that never sends anything and never reports an error
+type stalledBatchConn struct {
+	Conn
+	attempts		int
+}
+
+func (conn *stalledBatchConn) WriteBatch(ms []ipv6.Message, flags int) (int, error) {
+	conn.attempts++
+	return 0, nil
+}
+
+func TestNewEchoTemplate_MatchesMarshalledEcho(t *testing.T) {
+	template, err := newEchoTemplate()
+	assert.Nil(t, err)
+	assert.Len(t, template, 8 + cookiePayloadLength)
+	msg, err := icmp.ParseMessage(58, template)
+	assert.Nil(t, err)
+	assert.Equal(t, ipv6.ICMPTypeEchoRequest, msg.Type)
+	echo, ok := msg.Body.(*icmp.Echo)
+	assert.True(t, ok)
+	assert.Len(t, echo.Data, cookiePayloadLength)
+}
+
+func TestWriteBatchWithBackoff_GivesUpWhenNothingIsSent(t *testing.T) {
+	config.InitConfig()
+	engine := &Engine{sendRetryCount: 2}
+	conn := &stalledBatchConn{}
+	stats := &sendStats{}
+	msgs := make([]ipv6.Message, 3)
+	for i := range msgs {
+		msgs[i] = ipv6.Message{Buffers: [][]byte{{0}}, Addr: &net.IPAddr{IP: net.ParseIP("2001:db8::1")}}
+	}
+	assert.Equal(t, 0, engine.writeBatchWithBackoff(conn, msgs, stats, newTestSafetyMonitor()))
+	assert.Equal(t, 3, conn.attempts)
+	assert.Equal(t, uint64(3), stats.failed)
+}
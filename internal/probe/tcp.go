@@ -0,0 +1,93 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The length of a TCP header without any options
+const tcpHeaderLength = 20
+
+const (
+	tcpFlagSYN		= 0x02
+	tcpFlagRST		= 0x04
+	tcpFlagACK		= 0x10
+)
+
+// Parse a comma-separated list of TCP ports
+func ParseTCPPorts(toParse string) ([]int, error) {
+	var toReturn []int
+	seen := make(map[int]struct{})
+	for _, field := range strings.Split(toParse, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.New(fmt.Sprintf("'%s' is not a valid TCP port.", field))
+		}
+		if _, ok := seen[port]; ok {
+			continue
+		}
+		seen[port] = struct{}{}
+		toReturn = append(toReturn, port)
+	}
+	if len(toReturn) == 0 {
+		return nil, errors.New(fmt.Sprintf("No TCP ports found in '%s'.", toParse))
+	}
+	return toReturn, nil
+}
+
+// Write a TCP SYN from srcPort to dstPort with the given sequence number into b. The checksum is
+// left for the kernel to compute.
+func putTCPSyn(b []byte, srcPort int, dstPort int, seq uint32) {
+	binary.BigEndian.PutUint16(b[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(b[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint32(b[4:8], seq)
+	binary.BigEndian.PutUint32(b[8:12], 0)
+	b[12] = (tcpHeaderLength / 4) << 4
+	b[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(b[14:16], 65535)
+	binary.BigEndian.PutUint16(b[16:18], 0)
+	binary.BigEndian.PutUint16(b[18:20], 0)
+}
+
+// The fields of a TCP segment that replies to probes are checked against
+type tcpSegment struct {
+	srcPort			int
+	dstPort			int
+	ack				uint32
+	flags			byte
+}
+
+func parseTCPSegment(b []byte) (*tcpSegment, bool) {
+	if len(b) < tcpHeaderLength {
+		return nil, false
+	}
+	return &tcpSegment{
+		srcPort:	int(binary.BigEndian.Uint16(b[0:2])),
+		dstPort:	int(binary.BigEndian.Uint16(b[2:4])),
+		ack:		binary.BigEndian.Uint32(b[8:12]),
+		flags:		b[13],
+	}, true
+}
+
+// Convert a TCP segment into a result if it is the SYN-ACK or RST that a SYN probe would draw
+func parseTCPResult(segment *tcpSegment, src net.IP) (*Result, bool) {
+	var resultType ResultType
+	switch {
+	case segment.flags & (tcpFlagSYN | tcpFlagACK) == (tcpFlagSYN | tcpFlagACK):
+		resultType = TCP_SYN_ACK
+	case segment.flags & (tcpFlagRST | tcpFlagACK) == (tcpFlagRST | tcpFlagACK):
+		resultType = TCP_RST
+	default:
+		return nil, false
+	}
+	addr := src
+	return &Result{Type: resultType, Addr: &addr, Target: &addr, Port: segment.srcPort}, true
+}
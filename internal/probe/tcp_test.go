@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestParseTCPPorts(t *testing.T) {
+	ports, err := ParseTCPPorts("22, 80,443,80")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{22, 80, 443}, ports)
+	_, err = ParseTCPPorts("22,65536")
+	assert.NotNil(t, err)
+	_, err = ParseTCPPorts("")
+	assert.NotNil(t, err)
+}
+
+func TestParseTCPResult_OnlyAcceptsRepliesToSyns(t *testing.T) {
+	src := net.ParseIP("2001:db8::1")
+	b := make([]byte, tcpHeaderLength)
+	putTCPSyn(b, 40000, 443, 1234)
+	segment, ok := parseTCPSegment(b)
+	assert.True(t, ok)
+	_, ok = parseTCPResult(segment, src)
+	assert.False(t, ok)
+	segment.flags = tcpFlagSYN | tcpFlagACK
+	result, ok := parseTCPResult(segment, src)
+	assert.True(t, ok)
+	assert.Equal(t, TCP_SYN_ACK, result.Type)
+	assert.Equal(t, 40000, result.Port)
+	segment.flags = tcpFlagRST | tcpFlagACK
+	result, ok = parseTCPResult(segment, src)
+	assert.True(t, ok)
+	assert.Equal(t, TCP_RST, result.Type)
+}
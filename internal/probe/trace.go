@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"sort"
+	"time"
+)
+
+// The largest hop limit that a trace probe can be sent with
+const MaxTraceHops = 255
+
+// Create an engine that traces the route to each of its targets by sending every target one probe
+// for each hop limit from 1 to maxHops, in the manner of yarrp. The hop limit of each probe is
+// carried in its echo sequence number, so the Time Exceeded errors that routers send back can be
+// placed along the path without keeping any state for the probes that are in flight.
+func NewTracer(maxHops int, bandwidth string, drainTimeout time.Duration) (*Engine, error) {
+	if maxHops < 1 || maxHops > MaxTraceHops {
+		return nil, errors.New(fmt.Sprintf("Invalid maximum hop count %d (must be between 1 and %d).", maxHops, MaxTraceHops))
+	}
+	engine, err := NewEngine(PHASE_TRACE, bandwidth, drainTimeout)
+	if err != nil {
+		return nil, err
+	}
+	engine.hopLimits = make([]int, maxHops)
+	for i := range engine.hopLimits {
+		engine.hopLimits[i] = i + 1
+	}
+	engine.tracing = true
+
+	// Routes are traced with echo requests alone, and as traces are stateless targets are never retried
+	engine.icmp = true
+	engine.paramProblem = false
+	engine.tcpPorts = nil
+	engine.udpPorts = nil
+	engine.retryCount = 0
+	return engine, nil
+}
+
+func NewTracerFromConfig() (*Engine, error) {
+	return NewTracer(viper.GetInt("TraceMaxHops"), viper.GetString("PingScanBandwidth"), config.GetPingScanDrainDuration())
+}
+
+// A single response to a trace probe
+type Hop struct {
+	HopLimit		int					`json:"hop"`
+	Type			string				`json:"type"`
+	Addr			string				`json:"addr"`
+	RTT				time.Duration		`json:"rtt_ns"`
+}
+
+// The route to a single traced target. Hop limits that no response came back for are left out, and
+// the path ends at the first hop that the target (or a router refusing to forward to it) answered.
+type Path struct {
+	Target			string				`json:"target"`
+	Reached			bool				`json:"reached"`
+	Hops			[]*Hop				`json:"hops"`
+}
+
+// A PathSet assembles the results of a trace into the path to each target and the set of routers
+// that were seen along the way
+type PathSet struct {
+	paths			map[string]*Path
+	routers			map[string]*net.IP
+}
+
+func NewPathSet() *PathSet {
+	return &PathSet{
+		paths:		make(map[string]*Path),
+		routers:	make(map[string]*net.IP),
+	}
+}
+
+func (set *PathSet) Add(result *Result) {
+	target := result.Target.String()
+	path, ok := set.paths[target]
+	if !ok {
+		path = &Path{Target: target}
+		set.paths[target] = path
+	}
+	if result.Type == TIME_EXCEEDED {
+		set.routers[result.Addr.String()] = result.Addr
+	}
+	path.Hops = append(path.Hops, &Hop{
+		HopLimit:	result.Hop,
+		Type:		resultTypeNames[result.Type],
+		Addr:		result.Addr.String(),
+		RTT:		result.GetRTT(),
+	})
+}
+
+// Get the path to every target that any response was received for, ordered by target
+func (set *PathSet) GetPaths() []*Path {
+	var toReturn []*Path
+	for _, path := range set.paths {
+		sort.SliceStable(path.Hops, func(i, j int) bool {
+			return path.Hops[i].HopLimit < path.Hops[j].HopLimit
+		})
+
+		// Probes with any hop limit past the target's distance are all answered by the end of the path
+		for i, hop := range path.Hops {
+			if hop.Type != resultTypeNames[TIME_EXCEEDED] {
+				path.Hops = path.Hops[:i + 1]
+				path.Reached = hop.Type == resultTypeNames[ECHO_REPLY]
+				break
+			}
+		}
+		toReturn = append(toReturn, path)
+	}
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].Target < toReturn[j].Target
+	})
+	return toReturn
+}
+
+// Get the addresses of the routers that sent Time Exceeded errors, in address order
+func (set *PathSet) GetRouters() []*net.IP {
+	var toReturn []*net.IP
+	for _, router := range set.routers {
+		toReturn = append(toReturn, router)
+	}
+	sort.Slice(toReturn, func(i, j int) bool {
+		return bytes.Compare(toReturn[i].To16(), toReturn[j].To16()) < 0
+	})
+	return toReturn
+}
+
+// Write a path to w as a single line record
+func WritePath(w io.Writer, path *Path) error {
+	encoded, err := json.Marshal(path)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", encoded)
+	return err
+}
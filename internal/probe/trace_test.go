@@ -0,0 +1,42 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestPathSet_BuildsPathsAndRouters(t *testing.T) {
+	first := net.ParseIP("2001:db8:1::1")
+	second := net.ParseIP("2001:db8:2::1")
+	routers := []net.IP{net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::3")}
+	set := NewPathSet()
+	set.Add(&Result{Type: ECHO_REPLY, Addr: &first, Target: &first, Hop: 4})
+	set.Add(&Result{Type: TIME_EXCEEDED, Addr: &routers[1], Target: &first, Hop: 2})
+	set.Add(&Result{Type: ECHO_REPLY, Addr: &first, Target: &first, Hop: 3})
+	set.Add(&Result{Type: TIME_EXCEEDED, Addr: &routers[0], Target: &first, Hop: 1})
+	set.Add(&Result{Type: TIME_EXCEEDED, Addr: &routers[0], Target: &second, Hop: 1})
+	set.Add(&Result{Type: DESTINATION_UNREACHABLE, Code: 3, Addr: &routers[2], Target: &second, Hop: 3})
+
+	paths := set.GetPaths()
+	assert.Len(t, paths, 2)
+	assert.Equal(t, first.String(), paths[0].Target)
+	assert.True(t, paths[0].Reached)
+	assert.Len(t, paths[0].Hops, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{paths[0].Hops[0].HopLimit, paths[0].Hops[1].HopLimit, paths[0].Hops[2].HopLimit})
+	assert.Equal(t, second.String(), paths[1].Target)
+	assert.False(t, paths[1].Reached)
+	assert.Len(t, paths[1].Hops, 2)
+
+	found := set.GetRouters()
+	assert.Len(t, found, 2)
+	assert.Equal(t, "2001:db8::1", found[0].String())
+	assert.Equal(t, "2001:db8::2", found[1].String())
+}
+
+func TestNewTracer_InvalidHops(t *testing.T) {
+	_, err := NewTracer(0, "1G", 0)
+	assert.NotNil(t, err)
+	_, err = NewTracer(MaxTraceHops + 1, "1G", 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"fmt"
+	"golang.org/x/net/ipv6"
+	"net"
+	"syscall"
+)
+
+// A Transport opens the packet connections that probes are sent and received over
+type Transport interface {
+	Listen(protocol int) (Conn, error)
+}
+
+// A packet connection for a single upper-layer protocol over IPv6. This is the subset of
+// ipv6.PacketConn that the probe engine makes use of.
+type Conn interface {
+	ReadFrom(b []byte) (int, *ipv6.ControlMessage, net.Addr, error)
+	WriteTo(b []byte, cm *ipv6.ControlMessage, dst net.Addr) (int, error)
+	SetControlMessage(cf ipv6.ControlFlags, on bool) error
+	SetICMPFilter(f *ipv6.ICMPFilter) error
+	Close() error
+}
+
+// A Conn that can add a Destination Options extension header to every packet sent over it
+type OptionsConn interface {
+	Conn
+	SetDestinationOptions(header []byte) error
+}
+
+// RawTransport sends and receives packets over raw IPv6 sockets
+type RawTransport struct {}
+
+var curTransport Transport = &RawTransport{}
+
+// The offset of the checksum field in the headers of the protocols other than ICMPv6 that probes
+// are sent over. The kernel only computes the checksums of raw packets for other protocols once it
+// has been told where they go.
+var checksumOffsets = map[int]int{
+	6:	16,
+	17:	6,
+}
+
+func (transport *RawTransport) Listen(protocol int) (Conn, error) {
+	listener, err := net.ListenPacket(fmt.Sprintf("ip6:%d", protocol), "::")
+	if err != nil {
+		return nil, err
+	}
+	ipConn, ok := listener.(*net.IPConn)
+	if !ok {
+		listener.Close()
+		return nil, fmt.Errorf("unexpected connection type %T", listener)
+	}
+	raw, err := ipConn.SyscallConn()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	conn := &rawConn{PacketConn: ipv6.NewPacketConn(listener), raw: raw}
+	if offset, ok := checksumOffsets[protocol]; ok {
+		if err := conn.SetChecksum(true, offset); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// A raw IPv6 socket
+type rawConn struct {
+	*ipv6.PacketConn
+	raw				syscall.RawConn
+}
+
+// Set the transport that all subsequently-created probe engines will send probes over
+func UseTransport(transport Transport) {
+	curTransport = transport
+}
+
+func GetTransport() Transport {
+	return curTransport
+}
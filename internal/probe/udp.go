@@ -0,0 +1,277 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The length of a UDP header
+const udpHeaderLength = 8
+
+// A UDP service that probes can be sent to. Its request is one that servers answer, and carries
+// the probe's cookie (or the bits of it within mask) in a field that the answer echoes back.
+type udpService struct {
+	name			string
+	mask			uint32
+	request			func(cookie uint32) []byte
+	requestCookie	func(payload []byte) (uint32, bool)
+	replyCookie		func(payload []byte) (uint32, bool)
+}
+
+// The services that UDP probes can be sent to, by port
+var udpServices = map[int]*udpService{
+	53: {
+		name:			"DNS",
+		mask:			0xffff,
+		request:		newDNSRequest,
+		requestCookie:	getDNSCookie,
+		replyCookie:	getDNSReplyCookie,
+	},
+	123: {
+		name:			"NTP",
+		mask:			0xffffffff,
+		request:		newNTPRequest,
+		requestCookie:	getNTPRequestCookie,
+		replyCookie:	getNTPReplyCookie,
+	},
+	161: {
+		name:			"SNMP",
+		mask:			0x7fffffff,
+		request:		newSNMPRequest,
+		requestCookie:	getSNMPRequestCookie,
+		replyCookie:	getSNMPReplyCookie,
+	},
+}
+
+// Parse a comma-separated list of UDP ports, each of which must be one that there is a probe for
+func ParseUDPPorts(toParse string) ([]int, error) {
+	var toReturn []int
+	seen := make(map[int]struct{})
+	for _, field := range strings.Split(toParse, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if _, ok := udpServices[port]; err != nil || !ok {
+			return nil, errors.New(fmt.Sprintf("'%s' is not a UDP port that can be probed (expected one of %s).", field, getUDPServicePorts()))
+		}
+		if _, ok := seen[port]; ok {
+			continue
+		}
+		seen[port] = struct{}{}
+		toReturn = append(toReturn, port)
+	}
+	if len(toReturn) == 0 {
+		return nil, errors.New(fmt.Sprintf("No UDP ports found in '%s'.", toParse))
+	}
+	return toReturn, nil
+}
+
+func getUDPServicePorts() string {
+	var ports []int
+	for port := range udpServices {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	var toReturn []string
+	for _, port := range ports {
+		toReturn = append(toReturn, fmt.Sprintf("%d (%s)", port, udpServices[port].name))
+	}
+	return strings.Join(toReturn, ", ")
+}
+
+// Get the length of the longest UDP probe sent to any of the given ports
+func getUDPProbeLength(ports []int) int {
+	toReturn := 0
+	for _, port := range ports {
+		if length := udpHeaderLength + len(udpServices[port].request(0)); length > toReturn {
+			toReturn = length
+		}
+	}
+	return toReturn
+}
+
+// Build a UDP datagram from srcPort to dstPort. The checksum is left for the kernel to compute.
+func newUDPDatagram(srcPort int, dstPort int, payload []byte) []byte {
+	datagram := make([]byte, udpHeaderLength + len(payload))
+	binary.BigEndian.PutUint16(datagram[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(datagram[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[udpHeaderLength:], payload)
+	return datagram
+}
+
+type udpDatagram struct {
+	srcPort			int
+	dstPort			int
+	payload			[]byte
+}
+
+func parseUDPDatagram(b []byte) (*udpDatagram, bool) {
+	if len(b) < udpHeaderLength {
+		return nil, false
+	}
+	return &udpDatagram{
+		srcPort:	int(binary.BigEndian.Uint16(b[0:2])),
+		dstPort:	int(binary.BigEndian.Uint16(b[2:4])),
+		payload:	b[udpHeaderLength:],
+	}, true
+}
+
+// A recursive query for the name servers of the root zone, with the cookie in the query ID
+func newDNSRequest(cookie uint32) []byte {
+	request := make([]byte, 17)
+	binary.BigEndian.PutUint16(request[0:2], uint16(cookie))
+	binary.BigEndian.PutUint16(request[2:4], 0x0100)		// Recursion desired
+	binary.BigEndian.PutUint16(request[4:6], 1)			// One question
+	binary.BigEndian.PutUint16(request[13:15], 2)			// NS (after the empty root name)
+	binary.BigEndian.PutUint16(request[15:17], 1)			// IN
+	return request
+}
+
+func getDNSCookie(payload []byte) (uint32, bool) {
+	if len(payload) < 12 {
+		return 0, false
+	}
+	return uint32(binary.BigEndian.Uint16(payload[0:2])), true
+}
+
+// Any response counts, including errors like REFUSED from servers that don't recurse for us
+func getDNSReplyCookie(payload []byte) (uint32, bool) {
+	if len(payload) < 12 || payload[2] & 0x80 == 0 {
+		return 0, false
+	}
+	return getDNSCookie(payload)
+}
+
+// An NTPv4 client request with the cookie in the transmit timestamp, which servers copy into the
+// origin timestamp of their response
+func newNTPRequest(cookie uint32) []byte {
+	request := make([]byte, 48)
+	request[0] = 4 << 3 | 3
+	binary.BigEndian.PutUint32(request[40:44], cookie)
+	return request
+}
+
+func getNTPRequestCookie(payload []byte) (uint32, bool) {
+	if len(payload) < 48 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(payload[40:44]), true
+}
+
+func getNTPReplyCookie(payload []byte) (uint32, bool) {
+	if len(payload) < 48 || payload[0] & 0x07 != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(payload[24:28]), true
+}
+
+// The BER tags of the parts of an SNMP message
+const (
+	berInteger			= 0x02
+	berOctetString		= 0x04
+	berNull				= 0x05
+	berOID				= 0x06
+	berSequence			= 0x30
+	snmpGetRequest		= 0xa0
+	snmpResponse		= 0xa2
+)
+
+// The OID of sysDescr.0 (1.3.6.1.2.1.1.1.0)
+var snmpSysDescr = []byte{0x2b, 6, 1, 2, 1, 1, 1, 0}
+
+func appendBER(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag, byte(len(value)))
+	return append(b, value...)
+}
+
+// Get the minimal two's complement encoding of a non-negative BER INTEGER, which keeps a leading zero
+// byte only where it is needed to keep the value from reading as negative
+func getBERInteger(value uint32) []byte {
+	toReturn := make([]byte, 5)
+	binary.BigEndian.PutUint32(toReturn[1:], value)
+	for len(toReturn) > 1 && toReturn[0] == 0 && toReturn[1] & 0x80 == 0 {
+		toReturn = toReturn[1:]
+	}
+	return toReturn
+}
+
+// An SNMPv2c GetRequest for sysDescr.0 with the "public" community and the cookie in the request ID.
+// The high bit of the cookie is dropped so that the request ID fits in the four bytes that agents
+// are required to support.
+func newSNMPRequest(cookie uint32) []byte {
+	varBind := appendBER(appendBER(nil, berOID, snmpSysDescr), berNull, nil)
+	pdu := appendBER(nil, berInteger, getBERInteger(cookie & 0x7fffffff))
+	pdu = appendBER(pdu, berInteger, []byte{0})
+	pdu = appendBER(pdu, berInteger, []byte{0})
+	pdu = appendBER(pdu, berSequence, appendBER(nil, berSequence, varBind))
+	message := appendBER(nil, berInteger, []byte{1})
+	message = appendBER(message, berOctetString, []byte("public"))
+	message = appendBER(message, snmpGetRequest, pdu)
+	return appendBER(nil, berSequence, message)
+}
+
+// Read the tag and value of the BER element at the start of b, returning what follows it as well
+func readBER(b []byte) (byte, []byte, []byte, bool) {
+	if len(b) < 2 {
+		return 0, nil, nil, false
+	}
+	tag, length, offset := b[0], int(b[1]), 2
+	if length & 0x80 != 0 {
+		count := length & 0x7f
+		if count == 0 || count > 2 || len(b) < 2 + count {
+			return 0, nil, nil, false
+		}
+		length = 0
+		for _, c := range b[2:2 + count] {
+			length = length << 8 | int(c)
+		}
+		offset += count
+	}
+	if len(b) < offset + length {
+		return 0, nil, nil, false
+	}
+	return tag, b[offset:offset + length], b[offset + length:], true
+}
+
+// Get the PDU type and request ID of an SNMP message
+func getSNMPRequestID(payload []byte) (byte, uint32, bool) {
+	tag, message, _, ok := readBER(payload)
+	if !ok || tag != berSequence {
+		return 0, 0, false
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, message, ok = readBER(message); !ok {
+			return 0, 0, false
+		}
+	}
+	pduType, pdu, _, ok := readBER(message)
+	if !ok {
+		return 0, 0, false
+	}
+	tag, requestID, _, ok := readBER(pdu)
+	if !ok || tag != berInteger || len(requestID) == 0 || len(requestID) > 4 {
+		return 0, 0, false
+	}
+	var toReturn uint32
+	for _, c := range requestID {
+		toReturn = toReturn << 8 | uint32(c)
+	}
+	return pduType, toReturn, true
+}
+
+func getSNMPRequestCookie(payload []byte) (uint32, bool) {
+	pduType, requestID, ok := getSNMPRequestID(payload)
+	return requestID, ok && pduType == snmpGetRequest
+}
+
+func getSNMPReplyCookie(payload []byte) (uint32, bool) {
+	pduType, requestID, ok := getSNMPRequestID(payload)
+	return requestID, ok && pduType == snmpResponse
+}
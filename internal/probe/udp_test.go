@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseUDPPorts(t *testing.T) {
+	ports, err := ParseUDPPorts("161, 53,53")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{161, 53}, ports)
+	_, err = ParseUDPPorts("53,80")
+	assert.NotNil(t, err)
+	_, err = ParseUDPPorts("")
+	assert.NotNil(t, err)
+}
+
+func TestUDPServices_RequestsCarryCookie(t *testing.T) {
+	cookie := uint32(0xdeadbeef)
+	for port, service := range udpServices {
+		requestCookie, ok := service.requestCookie(service.request(cookie))
+		assert.True(t, ok, "port %d", port)
+		assert.Equal(t, cookie & service.mask, requestCookie, "port %d", port)
+		_, ok = service.replyCookie(service.request(cookie))
+		assert.False(t, ok, "port %d", port)
+	}
+}
+
+func TestGetBERInteger(t *testing.T) {
+	assert.Equal(t, []byte{0}, getBERInteger(0))
+	assert.Equal(t, []byte{0x7f}, getBERInteger(0x7f))
+	assert.Equal(t, []byte{0, 0x80}, getBERInteger(0x80))
+	assert.Equal(t, []byte{0x12, 0x34}, getBERInteger(0x1234))
+	assert.Equal(t, []byte{0, 0x80, 0, 0}, getBERInteger(0x800000))
+	assert.Equal(t, []byte{0x7f, 0xff, 0xff, 0xff}, getBERInteger(0x7fffffff))
+}
+
+func TestNewSNMPRequest_MatchesKnownGetRequest(t *testing.T) {
+
+	// snmpget -v2c -c public <host> 1.3.6.1.2.1.1.1.0 with a request ID of 0x1234
+	expected := []byte{
+		0x30, 0x27,
+		0x02, 0x01, 0x01,
+		0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1a,
+		0x02, 0x02, 0x12, 0x34,
+		0x02, 0x01, 0x00,
+		0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c,
+		0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00,
+		0x05, 0x00,
+	}
+	assert.Equal(t, expected, newSNMPRequest(0x1234))
+
+	// The high bit of the cookie never makes the request ID negative
+	request := newSNMPRequest(0x80801234)
+	assert.Equal(t, []byte{0x02, 0x04, 0x00, 0x80, 0x12, 0x34}, request[15:21])
+	requestID, ok := getSNMPRequestCookie(request)
+	assert.True(t, ok)
+	assert.EqualValues(t, 0x801234, requestID)
+}
+
+func TestGetSNMPRequestID_LongFormLength(t *testing.T) {
+	pdu := appendBER(nil, berInteger, []byte{0x12, 0x34})
+	pdu = append(pdu, make([]byte, 200)...)
+	message := appendBER(nil, berInteger, []byte{1})
+	message = appendBER(message, berOctetString, []byte("public"))
+	message = append(message, snmpResponse, 0x81, byte(len(pdu)))
+	message = append(message, pdu...)
+	payload := append([]byte{berSequence, 0x82, 0, byte(len(message))}, message...)
+	requestID, ok := getSNMPReplyCookie(payload)
+	assert.True(t, ok)
+	assert.EqualValues(t, 0x1234, requestID)
+}
@@ -0,0 +1,811 @@
+package simnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/time/rate"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// The hop limit that simulated replies arrive with
+const replyHopLimit = 64
+
+// The hop limit that Neighbor Discovery messages from hosts on the attached link arrive with
+const ndHopLimit = 255
+
+// How long after a connection is opened that routers on the attached link advertise themselves
+const routerAdvertisementDelay = 10 * time.Millisecond
+
+// The all-nodes link-local multicast group
+var allNodesGroup = net.ParseIP("ff02::1")
+
+// The index of the interface that probes are sent out of unless another is asked for
+const defaultIfIndex = 1
+
+// The TCP flags that simulated hosts set in reply to SYNs
+const (
+	tcpFlagSYN		= 0x02
+	tcpFlagRST		= 0x04
+	tcpFlagACK		= 0x10
+)
+
+// The flags that simulated hosts and routers set in Neighbor Discovery messages
+const (
+	naFlagSolicited			= 0x40
+	naFlagOverride			= 0x20
+	prefixFlagOnLink		= 0x80
+	prefixFlagAutonomous	= 0x40
+)
+
+// The next header value of a Destination Options header. Echo requests sent with one are answered
+// as if they were of their own protocol.
+const destinationOptionsProtocol = 60
+
+// The number of replies that can be queued on a connection before further replies are dropped
+const connBufferSize = 65536
+
+var errConnClosed = errors.New("use of closed simulated connection")
+var errNoBufferSpace = errors.New("no buffer space available")
+
+type lossyNetwork struct {
+	network			*net.IPNet
+	lossRate		float64
+}
+
+type limitedNetwork struct {
+	network			*net.IPNet
+	limiter			*rate.Limiter
+}
+
+type slowNetwork struct {
+	network			*net.IPNet
+	delay			time.Duration
+}
+
+type unreachableNetwork struct {
+	network			*net.IPNet
+	router			net.IP
+	code			int
+}
+
+// A router on the attached link that advertises an on-link prefix
+type advertisingRouter struct {
+	addr			net.IP
+	prefix			*net.IPNet
+	ifIndex			int
+}
+
+type reroutedNetwork struct {
+	network			*net.IPNet
+	ifIndex			int
+}
+
+type route struct {
+	network			*net.IPNet
+	routers			[]net.IP
+}
+
+// Network is an in-memory probe.Transport that answers probes on behalf of a declared population
+// of IPv6 hosts and networks. It allows the full discovery process to be run without raw socket
+// privileges or a live network connection.
+type Network struct {
+	lock			sync.Mutex
+	random			*rand.Rand
+	localAddr		net.IP
+	hosts			map[string]struct{}
+	listening		map[int]map[string]map[int]struct{}
+	aliased			[]*net.IPNet
+	lossy			[]*lossyNetwork
+	limited			[]*limitedNetwork
+	slow			[]*slowNetwork
+	unreachable		[]*unreachableNetwork
+	rerouted		[]*reroutedNetwork
+	routes			[]*route
+	probeCounts		map[string]int
+	probeTotal		int
+	writeFailures	int
+	icmpConns		map[*conn]struct{}
+	linkHosts		map[string]struct{}
+	routers			[]*advertisingRouter
+}
+
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		random:			rand.New(rand.NewSource(seed)),
+		localAddr:		net.ParseIP("2001:db8:ffff::1"),
+		hosts:			make(map[string]struct{}),
+		listening:		make(map[int]map[string]map[int]struct{}),
+		icmpConns:		make(map[*conn]struct{}),
+		linkHosts:		make(map[string]struct{}),
+		probeCounts:	make(map[string]int),
+	}
+}
+
+// Add hosts that respond to probes sent to their address
+func (network *Network) AddHosts(addrs []*net.IP) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	for _, addr := range addrs {
+		network.hosts[addr.String()] = struct{}{}
+	}
+}
+
+// Add hosts that ignore ICMPv6 echo requests but accept TCP connections on the given ports (and
+// answer SYNs to any other port with a RST). Hosts added with AddHosts answer every SYN with a RST.
+func (network *Network) AddTCPHosts(addrs []*net.IP, ports []int) {
+	network.addListeningHosts(6, addrs, ports)
+}
+
+// Add hosts that ignore ICMPv6 echo requests but run UDP services (DNS, NTP, or SNMP) on the given
+// ports, and answer UDP probes to any other port with an ICMPv6 Port Unreachable error. Hosts added
+// with AddHosts answer every UDP probe with a Port Unreachable error.
+func (network *Network) AddUDPHosts(addrs []*net.IP, ports []int) {
+	network.addListeningHosts(17, addrs, ports)
+}
+
+// Add hosts that ignore ICMPv6 echo requests but still process the extension headers of the
+// packets sent to them, and so answer echo requests carrying an unrecognized destination option
+// with an ICMPv6 Parameter Problem error. Hosts added with AddHosts do the same.
+func (network *Network) AddEchoFilteringHosts(addrs []*net.IP) {
+	network.addListeningHosts(destinationOptionsProtocol, addrs, nil)
+}
+
+func (network *Network) addListeningHosts(protocol int, addrs []*net.IP, ports []int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if _, ok := network.listening[protocol]; !ok {
+		network.listening[protocol] = make(map[string]map[int]struct{})
+	}
+	for _, addr := range addrs {
+		listening := make(map[int]struct{})
+		for _, port := range ports {
+			listening[port] = struct{}{}
+		}
+		network.listening[protocol][addr.String()] = listening
+	}
+}
+
+// Add addresses of hosts on the link that probes are sent out on. Link-local addresses answer
+// pings to the all-nodes multicast group, and every address answers Neighbor Solicitations for it.
+func (network *Network) AddLinkHosts(addrs []*net.IP) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	for _, addr := range addrs {
+		network.linkHosts[addr.String()] = struct{}{}
+	}
+}
+
+// Add a router on the link attached to the given interface that advertises prefix as on-link
+// shortly after each ICMPv6 connection is opened
+func (network *Network) AddAdvertisingRouter(router *net.IP, prefix *net.IPNet, ifIndex int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.routers = append(network.routers, &advertisingRouter{addr: *router, prefix: prefix, ifIndex: ifIndex})
+}
+
+// Add a network in which every address responds to probes
+func (network *Network) AddAliasedNetwork(aliased *net.IPNet) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.aliased = append(network.aliased, aliased)
+}
+
+// Add a network in which the given fraction (between 0 and 1) of probes and replies are lost
+func (network *Network) AddLossyNetwork(lossy *net.IPNet, lossRate float64) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.lossy = append(network.lossy, &lossyNetwork{
+		network:	lossy,
+		lossRate:	lossRate,
+	})
+}
+
+// Add a network that answers at most repliesPerSecond probes per second (with the given burst)
+// across all of the addresses within it
+func (network *Network) AddRateLimitedNetwork(limited *net.IPNet, repliesPerSecond float64, burst int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.limited = append(network.limited, &limitedNetwork{
+		network:	limited,
+		limiter:	rate.NewLimiter(rate.Limit(repliesPerSecond), burst),
+	})
+}
+
+// Add a network whose replies only arrive after the given delay
+func (network *Network) AddSlowNetwork(slow *net.IPNet, delay time.Duration) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.slow = append(network.slow, &slowNetwork{
+		network:	slow,
+		delay:		delay,
+	})
+}
+
+// Add a network for which the given router answers every probe with an ICMPv6 Destination
+// Unreachable message with the given code
+func (network *Network) AddUnreachableNetwork(unreachable *net.IPNet, router *net.IP, code int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.unreachable = append(network.unreachable, &unreachableNetwork{
+		network:	unreachable,
+		router:		*router,
+		code:		code,
+	})
+}
+
+// Add a network whose replies arrive on the interface with the given index, regardless of which
+// interface the probes were sent out of
+func (network *Network) AddReroutedNetwork(rerouted *net.IPNet, ifIndex int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.rerouted = append(network.rerouted, &reroutedNetwork{
+		network:	rerouted,
+		ifIndex:	ifIndex,
+	})
+}
+
+// Add a network that is reached through the given routers in order. A probe to an address within it
+// whose hop limit runs out on reaching one of the routers is answered by that router with an
+// ICMPv6 Time Exceeded message.
+func (network *Network) AddRoute(routed *net.IPNet, routers []*net.IP) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	toAdd := &route{network: routed}
+	for _, router := range routers {
+		toAdd.routers = append(toAdd.routers, *router)
+	}
+	network.routes = append(network.routes, toAdd)
+}
+
+// Make the next count probes sent into the network fail as if the socket buffer were full
+func (network *Network) FailWrites(count int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.writeFailures = count
+}
+
+// Report whether the next write should fail, consuming one of the configured failures
+func (network *Network) shouldFailWrite() bool {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if network.writeFailures > 0 {
+		network.writeFailures--
+		return true
+	}
+	return false
+}
+
+// Get the number of probes that have been sent to the given address
+func (network *Network) GetProbeCount(addr *net.IP) int {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	return network.probeCounts[addr.String()]
+}
+
+// Get the total number of probes that have been sent into the network
+func (network *Network) GetTotalProbeCount() int {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	return network.probeTotal
+}
+
+func (network *Network) Listen(protocol int) (probe.Conn, error) {
+	if protocol != 58 && protocol != 6 && protocol != 17 {
+		return nil, fmt.Errorf("simulated network does not support protocol %d", protocol)
+	}
+	c := newConn(network, protocol)
+	if protocol == 58 {
+		network.lock.Lock()
+		network.icmpConns[c] = struct{}{}
+		routers := append([]*advertisingRouter{}, network.routers...)
+		network.lock.Unlock()
+		for _, router := range routers {
+			c.advertise(router)
+		}
+	}
+	return c, nil
+}
+
+// Deliver an ICMPv6 error to every open ICMPv6 connection like the kernel does for raw sockets,
+// whichever protocol the probe that drew it was sent over
+func (network *Network) deliverError(msg *icmp.Message, src net.IP, path *replyPath, delay time.Duration) {
+	network.lock.Lock()
+	conns := make([]*conn, 0, len(network.icmpConns))
+	for c := range network.icmpConns {
+		conns = append(conns, c)
+	}
+	network.lock.Unlock()
+	for _, c := range conns {
+		c.deliverAfter(msg, src, path, delay)
+	}
+}
+
+// Record that a probe was sent to the given address, returning the router that the probe expires at
+// given its hop limit (nil if it reaches its destination)
+func (network *Network) countProbe(addr net.IP, hopLimit int) net.IP {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.probeCounts[addr.String()]++
+	network.probeTotal++
+	for _, route := range network.routes {
+		if route.network.Contains(addr) && hopLimit > 0 && hopLimit <= len(route.routers) {
+			return route.routers[hopLimit - 1]
+		}
+	}
+	return nil
+}
+
+// Determine whether or not a probe of the given protocol sent to the given address should be
+// answered, and if so by which router (nil if the probed host itself answers)
+func (network *Network) shouldReply(addr net.IP, protocol int) (bool, *unreachableNetwork) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if !network.isAlive(addr, protocol) {
+		for _, unreachable := range network.unreachable {
+			if unreachable.network.Contains(addr) {
+				return true, unreachable
+			}
+		}
+		return false, nil
+	}
+	for _, lossy := range network.lossy {
+		if lossy.network.Contains(addr) && network.random.Float64() < lossy.lossRate {
+			return false, nil
+		}
+	}
+	for _, limited := range network.limited {
+		if limited.network.Contains(addr) && !limited.limiter.Allow() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Get how long replies to probes sent to the given address take to arrive
+func (network *Network) getDelay(addr net.IP) time.Duration {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	for _, slow := range network.slow {
+		if slow.network.Contains(addr) {
+			return slow.delay
+		}
+	}
+	return 0
+}
+
+// Get the interface that replies to probes sent to the given address arrive on, given the interface
+// that the probes were sent out of
+func (network *Network) getReplyIfIndex(addr net.IP, sentOn int) int {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	for _, rerouted := range network.rerouted {
+		if rerouted.network.Contains(addr) {
+			return rerouted.ifIndex
+		}
+	}
+	return sentOn
+}
+
+// Get whether or not the given TCP or UDP port is open on the given address
+func (network *Network) isListening(addr net.IP, protocol int, port int) bool {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	_, ok := network.listening[protocol][addr.String()][port]
+	return ok
+}
+
+func (network *Network) isLinkHost(addr net.IP) bool {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	_, ok := network.linkHosts[addr.String()]
+	return ok
+}
+
+func (network *Network) getLinkLocalHosts() []net.IP {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	var toReturn []net.IP
+	for host := range network.linkHosts {
+		if addr := net.ParseIP(host); addr.IsLinkLocalUnicast() {
+			toReturn = append(toReturn, addr)
+		}
+	}
+	return toReturn
+}
+
+func (network *Network) isAlive(addr net.IP, protocol int) bool {
+	if _, ok := network.hosts[addr.String()]; ok {
+		return true
+	}
+	if _, ok := network.listening[protocol][addr.String()]; ok {
+		return true
+	}
+	for _, aliased := range network.aliased {
+		if aliased.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type packet struct {
+	data			[]byte
+	src				net.IP
+	dst				net.IP
+	ifIndex			int
+	hopLimit		int
+}
+
+// The address and interface that the replies to a probe are delivered to, and the hop limit that
+// they arrive with (replyHopLimit if zero)
+type replyPath struct {
+	dst				net.IP
+	ifIndex			int
+	hopLimit		int
+}
+
+type conn struct {
+	network			*Network
+	protocol		int
+	options			[]byte
+	filter			*ipv6.ICMPFilter
+	filterLock		sync.Mutex
+	packets			chan *packet
+	closed			chan struct{}
+	closeOnce		sync.Once
+}
+
+func newConn(network *Network, protocol int) *conn {
+	return &conn{
+		network:	network,
+		protocol:	protocol,
+		packets:	make(chan *packet, connBufferSize),
+		closed:		make(chan struct{}),
+	}
+}
+
+func (c *conn) ReadFrom(b []byte) (int, *ipv6.ControlMessage, net.Addr, error) {
+
+	// Deliver any queued packets before reporting that the connection is closed
+	var pkt *packet
+	select {
+	case pkt = <-c.packets:
+	default:
+		select {
+		case pkt = <-c.packets:
+		case <-c.closed:
+			return 0, nil, nil, errConnClosed
+		}
+	}
+
+	n := copy(b, pkt.data)
+	hopLimit := replyHopLimit
+	if pkt.hopLimit != 0 {
+		hopLimit = pkt.hopLimit
+	}
+	cm := &ipv6.ControlMessage{
+		HopLimit:	hopLimit,
+		Dst:		pkt.dst,
+		IfIndex:	pkt.ifIndex,
+	}
+	return n, cm, &net.IPAddr{IP: pkt.src}, nil
+}
+
+func (c *conn) WriteTo(b []byte, cm *ipv6.ControlMessage, dst net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errConnClosed
+	default:
+	}
+	if c.network.shouldFailWrite() {
+		return 0, errNoBufferSpace
+	}
+	dstAddr, ok := dst.(*net.IPAddr)
+	if !ok {
+		return 0, fmt.Errorf("unexpected destination address type %T", dst)
+	}
+	hopLimit := 0
+	if cm != nil {
+		hopLimit = cm.HopLimit
+	}
+
+	// Replies come back to the address and interface that the probe was sent from
+	path := &replyPath{dst: c.network.localAddr, ifIndex: defaultIfIndex}
+	if cm != nil && cm.Src != nil {
+		path.dst = cm.Src
+	}
+	if cm != nil && cm.IfIndex != 0 {
+		path.ifIndex = cm.IfIndex
+	}
+	path.ifIndex = c.network.getReplyIfIndex(dstAddr.IP, path.ifIndex)
+
+	// Ignore anything that isn't a probe
+	var echo *icmp.Message
+	protocol := c.protocol
+	switch c.protocol {
+	case 6:
+		if len(b) < 20 || b[13] != tcpFlagSYN {
+			return len(b), nil
+		}
+	case 17:
+		if len(b) < 8 {
+			return len(b), nil
+		}
+	default:
+		msg, err := icmp.ParseMessage(58, b)
+		if err != nil {
+			return 0, err
+		}
+		if dstAddr.IP.IsMulticast() {
+			c.answerLink(msg, dstAddr.IP, path)
+			return len(b), nil
+		}
+		if msg.Type != ipv6.ICMPTypeEchoRequest {
+			return len(b), nil
+		}
+		echo = msg
+		if c.options != nil {
+			protocol = destinationOptionsProtocol
+		}
+	}
+	delay := c.network.getDelay(dstAddr.IP)
+
+	if router := c.network.countProbe(dstAddr.IP, hopLimit); router != nil {
+		c.network.deliverError(&icmp.Message{
+			Type:	ipv6.ICMPTypeTimeExceeded,
+			Code:	0,
+			Body:	&icmp.TimeExceeded{Data: c.quote(b, path.dst, dstAddr.IP)},
+		}, router, path, delay)
+		return len(b), nil
+	}
+	reply, unreachable := c.network.shouldReply(dstAddr.IP, protocol)
+	if !reply {
+		return len(b), nil
+	}
+	if unreachable != nil {
+		c.network.deliverError(&icmp.Message{
+			Type:	ipv6.ICMPTypeDestinationUnreachable,
+			Code:	unreachable.code,
+			Body:	&icmp.DstUnreach{Data: c.quote(b, path.dst, dstAddr.IP)},
+		}, unreachable.router, path, delay)
+		return len(b), nil
+	}
+	switch protocol {
+	case 6:
+		c.answerTCP(b, dstAddr.IP, path, delay)
+	case 17:
+		c.answerUDP(b, dstAddr.IP, path, delay)
+	case destinationOptionsProtocol:
+
+		// The option's type says to discard the packet and point the sender at the option (just
+		// past the IPv6 header and the first two bytes of the Destination Options header)
+		c.network.deliverError(&icmp.Message{
+			Type:	ipv6.ICMPTypeParameterProblem,
+			Code:	2,
+			Body:	&icmp.ParamProb{Pointer: 42, Data: c.quote(b, path.dst, dstAddr.IP)},
+		}, dstAddr.IP, path, delay)
+	default:
+		echoReply := icmp.Message{
+			Type:	ipv6.ICMPTypeEchoReply,
+			Code:	0,
+			Body:	echo.Body,
+		}
+		c.deliverAfter(&echoReply, dstAddr.IP, path, delay)
+	}
+	return len(b), nil
+}
+
+// Answer a TCP SYN like the probed host would, with a SYN-ACK if it is listening on the port and a
+// RST otherwise
+func (c *conn) answerTCP(b []byte, dst net.IP, path *replyPath, delay time.Duration) {
+	srcPort, dstPort := binary.BigEndian.Uint16(b[0:2]), binary.BigEndian.Uint16(b[2:4])
+	segment := make([]byte, 20)
+	binary.BigEndian.PutUint16(segment[0:2], dstPort)
+	binary.BigEndian.PutUint16(segment[2:4], srcPort)
+	binary.BigEndian.PutUint32(segment[8:12], binary.BigEndian.Uint32(b[4:8]) + 1)
+	segment[12] = 5 << 4
+	segment[13] = tcpFlagRST | tcpFlagACK
+	if c.network.isListening(dst, 6, int(dstPort)) {
+		segment[13] = tcpFlagSYN | tcpFlagACK
+		binary.BigEndian.PutUint16(segment[14:16], 65535)
+	}
+	c.queueAfter(segment, dst, path, delay)
+}
+
+// Answer a UDP probe like the probed host would, with a reply from the service if it runs one on
+// the port and an ICMPv6 Port Unreachable error otherwise
+func (c *conn) answerUDP(b []byte, dst net.IP, path *replyPath, delay time.Duration) {
+	srcPort, dstPort := binary.BigEndian.Uint16(b[0:2]), binary.BigEndian.Uint16(b[2:4])
+	if !c.network.isListening(dst, 17, int(dstPort)) {
+		c.network.deliverError(&icmp.Message{
+			Type:	ipv6.ICMPTypeDestinationUnreachable,
+			Code:	4,
+			Body:	&icmp.DstUnreach{Data: c.quote(b, path.dst, dst)},
+		}, dst, path, delay)
+		return
+	}
+	payload, ok := getServiceReply(int(dstPort), b[8:])
+	if !ok {
+		return
+	}
+	datagram := make([]byte, 8 + len(payload))
+	binary.BigEndian.PutUint16(datagram[0:2], dstPort)
+	binary.BigEndian.PutUint16(datagram[2:4], srcPort)
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[8:], payload)
+	c.queueAfter(datagram, dst, path, delay)
+}
+
+// Answer a message sent to a multicast group on the attached link like the hosts on it would. Hosts
+// answer pings to the all-nodes group from their link-local addresses, and Neighbor Solicitations
+// are answered by the host with the address that they are for.
+func (c *conn) answerLink(msg *icmp.Message, dst net.IP, path *replyPath) {
+	linkPath := &replyPath{dst: path.dst, ifIndex: path.ifIndex, hopLimit: ndHopLimit}
+	switch msg.Type {
+	case ipv6.ICMPTypeEchoRequest:
+		if !dst.Equal(allNodesGroup) {
+			return
+		}
+		for _, host := range c.network.getLinkLocalHosts() {
+			c.deliverAfter(&icmp.Message{Type: ipv6.ICMPTypeEchoReply, Body: msg.Body}, host, path, 0)
+		}
+	case ipv6.ICMPTypeNeighborSolicitation:
+		body, ok := msg.Body.(*icmp.DefaultMessageBody)
+		if !ok || len(body.Data) < 20 {
+			return
+		}
+		target := net.IP(body.Data[4:20])
+		if !c.network.isLinkHost(target) {
+			return
+		}
+		data := make([]byte, 20)
+		data[0] = naFlagSolicited | naFlagOverride
+		copy(data[4:], target)
+		c.deliverAfter(&icmp.Message{Type: ipv6.ICMPTypeNeighborAdvertisement, Body: &icmp.DefaultMessageBody{Data: data}}, target, linkPath, 0)
+	}
+}
+
+// Have a router send a Router Advertisement for its prefix to the all-nodes group shortly, which
+// arrives on this connection if it is still open and its ICMP filter lets it through by then
+func (c *conn) advertise(router *advertisingRouter) {
+	data := make([]byte, 12 + 32)
+	data[0] = 64
+	binary.BigEndian.PutUint16(data[2:4], 1800)
+	option := data[12:]
+	option[0] = 3
+	option[1] = 4
+	ones, _ := router.prefix.Mask.Size()
+	option[2] = byte(ones)
+	option[3] = prefixFlagOnLink | prefixFlagAutonomous
+	binary.BigEndian.PutUint32(option[4:8], 2592000)
+	binary.BigEndian.PutUint32(option[8:12], 604800)
+	copy(option[16:32], router.prefix.IP.To16())
+	msg := &icmp.Message{Type: ipv6.ICMPTypeRouterAdvertisement, Body: &icmp.DefaultMessageBody{Data: data}}
+	path := &replyPath{dst: allNodesGroup, ifIndex: router.ifIndex, hopLimit: ndHopLimit}
+	time.AfterFunc(routerAdvertisementDelay, func() {
+		select {
+		case <-c.closed:
+		default:
+			c.deliverAfter(msg, router.addr, path, 0)
+		}
+	})
+}
+
+// Send each of the messages in turn, stopping at the first one that fails like sendmmsg does
+func (c *conn) WriteBatch(ms []ipv6.Message, flags int) (int, error) {
+	for i, m := range ms {
+		var cm *ipv6.ControlMessage
+		if len(m.OOB) > 0 {
+			cm = &ipv6.ControlMessage{}
+			if err := cm.Parse(m.OOB); err != nil {
+				return i, err
+			}
+
+			// Parse reads packet info as it is received, where its address is the destination, but
+			// on a sent packet it is the source
+			cm.Src, cm.Dst = cm.Dst, nil
+		}
+		n, err := c.WriteTo(m.Buffers[0], cm, m.Addr)
+		if err != nil {
+			return i, err
+		}
+		ms[i].N = n
+	}
+	return len(ms), nil
+}
+
+// Rebuild the IPv6 packet that carried the given probe (along with the connection's Destination
+// Options header if it has one), as quoted in ICMPv6 errors
+func (c *conn) quote(b []byte, src net.IP, dst net.IP) []byte {
+	quoted := make([]byte, 40 + len(c.options) + len(b))
+	quoted[0] = 6 << 4
+	binary.BigEndian.PutUint16(quoted[4:6], uint16(len(c.options) + len(b)))
+	quoted[6] = byte(c.protocol)
+	quoted[7] = 255
+	copy(quoted[8:24], src.To16())
+	copy(quoted[24:40], dst.To16())
+	if c.options != nil {
+		quoted[6] = destinationOptionsProtocol
+		copy(quoted[40:], c.options)
+		quoted[40] = byte(c.protocol)
+	}
+	copy(quoted[40 + len(c.options):], b)
+	return quoted
+}
+
+// Queue an ICMPv6 message for receipt on this connection after the delay, honoring the
+// connection's ICMP filter
+func (c *conn) deliverAfter(msg *icmp.Message, src net.IP, path *replyPath, delay time.Duration) {
+	icmpType, ok := msg.Type.(ipv6.ICMPType)
+	if !ok || c.blocks(icmpType) {
+		return
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return
+	}
+	c.queueAfter(data, src, path, delay)
+}
+
+// Whether the connection's ICMP filter drops messages of the type. The filter can be set while
+// replies are being delivered to the connection from other goroutines.
+func (c *conn) blocks(icmpType ipv6.ICMPType) bool {
+	c.filterLock.Lock()
+	defer c.filterLock.Unlock()
+	return c.filter != nil && c.filter.WillBlock(icmpType)
+}
+
+// Queue a packet for receipt on this connection after the delay
+func (c *conn) queueAfter(data []byte, src net.IP, path *replyPath, delay time.Duration) {
+	srcCopy := make(net.IP, len(src))
+	copy(srcCopy, src)
+	pkt := &packet{data: data, src: srcCopy, dst: path.dst, ifIndex: path.ifIndex, hopLimit: path.hopLimit}
+	if delay <= 0 {
+		c.queue(pkt)
+		return
+	}
+	time.AfterFunc(delay, func() { c.queue(pkt) })
+}
+
+func (c *conn) queue(pkt *packet) {
+	select {
+	case c.packets <- pkt:
+	default:
+		// Receive buffer is full, drop the packet like a real socket would
+	}
+}
+
+func (c *conn) SetControlMessage(cf ipv6.ControlFlags, on bool) error {
+	return nil
+}
+
+func (c *conn) SetDestinationOptions(header []byte) error {
+	c.options = make([]byte, len(header))
+	copy(c.options, header)
+	return nil
+}
+
+func (c *conn) SetICMPFilter(f *ipv6.ICMPFilter) error {
+	filter := *f
+	c.filterLock.Lock()
+	c.filter = &filter
+	c.filterLock.Unlock()
+	return nil
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.network.lock.Lock()
+		delete(c.network.icmpConns, c)
+		c.network.lock.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,540 @@
+package simnet
+
+import (
+	"github.com/lavalamp-/ipv666/internal/addressing"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	config.InitConfig()
+	viper.Set("PingScanRetryCount", 0)
+	viper.Set("PingScanRetryTimeout", 0.05)
+	viper.Set("PingScanPrefixRate", 0)
+	viper.Set("PingScanDrainTimeout", 0.05)
+}
+
+func newEngine(drainTimeout time.Duration) *probe.Engine {
+	engine, _ := probe.NewEngine(probe.PHASE_GENERATE, "1G", drainTimeout)
+	return engine
+}
+
+func probeNetwork(network *Network, addrs []*net.IP) []*probe.Result {
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	targets := make(chan *net.IP)
+	results, _ := newEngine(50 * time.Millisecond).Probe(targets)
+	go func() {
+		for _, addr := range addrs {
+			targets <- addr
+		}
+		close(targets)
+	}()
+	var toReturn []*probe.Result
+	for result := range results {
+		toReturn = append(toReturn, result)
+	}
+	return toReturn
+}
+
+func probeAddresses(network *Network, addrs []*net.IP) []*net.IP {
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	found, _ := probe.ProbeAddresses(newEngine(50 * time.Millisecond), addrs)
+	return found
+}
+
+func getTestingIP(toParse string) *net.IP {
+	toReturn := net.ParseIP(toParse)
+	return &toReturn
+}
+
+func TestNetwork_HostsRespond(t *testing.T) {
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2")})
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+	assert.Len(t, found, 2)
+	set := addressing.GetIPSet(found)
+	assert.Contains(t, set, "2001:db8::1")
+	assert.Contains(t, set, "2001:db8::2")
+}
+
+func TestNetwork_AliasedNetworkResponds(t *testing.T) {
+	network := NewNetwork(1)
+	_, aliased, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(aliased)
+	addrs := addressing.GenerateRandomAddressesInNetwork(aliased, 20)
+	found := probeAddresses(network, append(addrs, getTestingIP("2001:db8:2::1")))
+	assert.Len(t, found, 20)
+}
+
+func TestNetwork_LossyNetworkDropsProbes(t *testing.T) {
+	network := NewNetwork(1)
+	_, lossy, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(lossy)
+	network.AddLossyNetwork(lossy, 0.5)
+	found := probeAddresses(network, addressing.GenerateRandomAddressesInNetwork(lossy, 1000))
+	assert.InDelta(t, 500, len(found), 100)
+}
+
+func TestNetwork_RetriesRecoverLostProbes(t *testing.T) {
+	viper.Set("PingScanRetryCount", 3)
+	defer viper.Set("PingScanRetryCount", 0)
+	network := NewNetwork(1)
+	_, lossy, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(lossy)
+	network.AddLossyNetwork(lossy, 0.5)
+	found := probeAddresses(network, addressing.GenerateRandomAddressesInNetwork(lossy, 1000))
+	assert.InDelta(t, 937, len(found), 40)
+}
+
+func TestNetwork_RateLimitedNetworkDropsReplies(t *testing.T) {
+	network := NewNetwork(1)
+	_, limited, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(limited)
+	network.AddRateLimitedNetwork(limited, 1, 10)
+	found := probeAddresses(network, addressing.GenerateRandomAddressesInNetwork(limited, 100))
+	assert.True(t, len(found) >= 10 && len(found) < 20)
+}
+
+func TestNetwork_CountsProbes(t *testing.T) {
+	network := NewNetwork(1)
+	probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2")})
+	assert.EqualValues(t, 2, network.GetProbeCount(getTestingIP("2001:db8::1")))
+	assert.EqualValues(t, 3, network.GetTotalProbeCount())
+}
+
+func TestNetwork_UnreachableNetworkSendsErrors(t *testing.T) {
+	network := NewNetwork(1)
+	_, unreachable, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddUnreachableNetwork(unreachable, getTestingIP("2001:db8::ffff"), 3)
+	results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8:1::1")})
+	assert.Len(t, results, 1)
+	assert.Equal(t, probe.DESTINATION_UNREACHABLE, results[0].Type)
+	assert.Equal(t, 3, results[0].Code)
+	assert.Equal(t, "2001:db8::ffff", results[0].Addr.String())
+	assert.Equal(t, "2001:db8:1::1", results[0].Target.String())
+}
+
+func TestNetwork_ResultsCarryProbeMetadata(t *testing.T) {
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8::1")})
+	assert.Len(t, results, 1)
+	assert.Equal(t, probe.PHASE_GENERATE, results[0].Phase)
+	assert.Equal(t, 64, results[0].HopLimit)
+	assert.Equal(t, 1, results[0].IfIndex)
+	assert.False(t, results[0].SentAt.IsZero())
+	assert.True(t, results[0].GetRTT() >= 0)
+}
+
+func TestNetwork_ScanWaitsForEndOfTargets(t *testing.T) {
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2")})
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// A pause in the targets that is longer than the drain period shouldn't end the scan
+	targets := make(chan *net.IP)
+	results, _ := newEngine(50 * time.Millisecond).Probe(targets)
+	go func() {
+		targets <- getTestingIP("2001:db8::1")
+		time.Sleep(200 * time.Millisecond)
+		targets <- getTestingIP("2001:db8::2")
+		close(targets)
+	}()
+	count := 0
+	for range results {
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestNetwork_ScanDrainsLateReplies(t *testing.T) {
+	network := NewNetwork(1)
+	_, slow, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(slow)
+	network.AddSlowNetwork(slow, 100 * time.Millisecond)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	addrs := addressing.GenerateRandomAddressesInNetwork(slow, 10)
+
+	found, _ := probe.ProbeAddresses(newEngine(0), addrs)
+	assert.Len(t, found, 0)
+	found, _ = probe.ProbeAddresses(newEngine(500 * time.Millisecond), addrs)
+	assert.Len(t, found, 10)
+}
+
+func TestNetwork_RefusedSendsAreRetried(t *testing.T) {
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	network.FailWrites(3)
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1")})
+	assert.Len(t, found, 1)
+}
+
+func TestNetwork_RefusedSendsAreAbandoned(t *testing.T) {
+	viper.Set("PingScanSendRetryCount", 2)
+	defer viper.Set("PingScanSendRetryCount", 8)
+	abandoned := metrics.Get("probe.sends.abandoned.count").(metrics.Counter)
+	before := abandoned.Count()
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	network.FailWrites(3)
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1")})
+	assert.Len(t, found, 0)
+	assert.EqualValues(t, 1, abandoned.Count() - before)
+}
+
+func TestNetwork_BatchedSendersProbeEveryTarget(t *testing.T) {
+	viper.Set("PingScanBatchSize", 16)
+	viper.Set("PingScanSenderCount", 4)
+	defer viper.Set("PingScanBatchSize", 64)
+	defer viper.Set("PingScanSenderCount", 1)
+	network := NewNetwork(1)
+	_, aliased, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddAliasedNetwork(aliased)
+	found := probeAddresses(network, addressing.GenerateRandomAddressesInNetwork(aliased, 1000))
+	assert.Len(t, found, 1000)
+	assert.Equal(t, 1000, network.GetTotalProbeCount())
+}
+
+func TestNetwork_ObjectingNetworkHaltsScan(t *testing.T) {
+	viper.Set("PingScanRate", 2000)
+	viper.Set("PingScanHaltPrefixObjections", 10)
+	defer viper.Set("PingScanRate", 0)
+	defer viper.Set("PingScanHaltPrefixObjections", 1000)
+	network := NewNetwork(1)
+	_, prohibited, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddUnreachableNetwork(prohibited, getTestingIP("2001:db8::ffff"), 1)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	addrs := addressing.GenerateRandomAddressesInNetwork(prohibited, 5000)
+
+	_, err := probe.ProbeAddresses(newEngine(50 * time.Millisecond), addrs)
+	assert.IsType(t, &probe.HaltError{}, err)
+	assert.True(t, network.GetTotalProbeCount() < len(addrs))
+}
+
+func TestNetwork_UnreachableAddressesDoNotHaltScan(t *testing.T) {
+	viper.Set("PingScanRate", 2000)
+	viper.Set("PingScanHaltMinSamples", 100)
+	viper.Set("PingScanHaltInterval", 0.1)
+	defer viper.Set("PingScanRate", 0)
+	defer viper.Set("PingScanHaltMinSamples", 1000)
+	defer viper.Set("PingScanHaltInterval", 1)
+	network := NewNetwork(1)
+	_, empty, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddUnreachableNetwork(empty, getTestingIP("2001:db8::ffff"), 3)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	addrs := addressing.GenerateRandomAddressesInNetwork(empty, 1000)
+
+	_, err := probe.ProbeAddresses(newEngine(50 * time.Millisecond), addrs)
+	assert.Nil(t, err)
+	assert.Equal(t, len(addrs), network.GetTotalProbeCount())
+}
+
+func TestNetwork_ExcludedNetworksAreNeverProbed(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "exclusions")
+	defer os.RemoveAll(dir)
+	baseDir := viper.GetString("BaseOutputDirectory")
+	viper.Set("BaseOutputDirectory", dir)
+	defer viper.Set("BaseOutputDirectory", baseDir)
+	ioutil.WriteFile(config.GetExclusionFilePath(), []byte("2001:db8:2::/48\n"), 0644)
+
+	network := NewNetwork(1)
+	_, allowed, _ := net.ParseCIDR("2001:db8:1::/48")
+	_, excluded, _ := net.ParseCIDR("2001:db8:2::/48")
+	network.AddAliasedNetwork(allowed)
+	network.AddAliasedNetwork(excluded)
+	addrs := append(addressing.GenerateRandomAddressesInNetwork(allowed, 10), addressing.GenerateRandomAddressesInNetwork(excluded, 5)...)
+	found := probeAddresses(network, addrs)
+	assert.Len(t, found, 10)
+	assert.Equal(t, 10, network.GetTotalProbeCount())
+
+	logged, err := ioutil.ReadFile(config.GetExclusionLogFilePath())
+	assert.Nil(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(logged)), "\n"), 5)
+	assert.Contains(t, string(logged), addrs[10].String())
+}
+
+func TestNetwork_BoundScanIgnoresOtherInterfaces(t *testing.T) {
+	loopback, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface named 'lo'")
+	}
+	viper.Set("PingScanInterface", "lo")
+	viper.Set("PingScanSourceAddress", "::1")
+	defer viper.Set("PingScanInterface", "")
+	defer viper.Set("PingScanSourceAddress", "")
+	network := NewNetwork(1)
+	_, bound, _ := net.ParseCIDR("2001:db8:1::/48")
+	_, other, _ := net.ParseCIDR("2001:db8:2::/48")
+	network.AddAliasedNetwork(bound)
+	network.AddAliasedNetwork(other)
+	network.AddReroutedNetwork(other, loopback.Index + 1)
+	addrs := append(addressing.GenerateRandomAddressesInNetwork(bound, 10), addressing.GenerateRandomAddressesInNetwork(other, 10)...)
+
+	results := probeNetwork(network, addrs)
+	assert.Len(t, results, 10)
+	for _, result := range results {
+		assert.True(t, bound.Contains(*result.Addr))
+		assert.Equal(t, loopback.Index, result.IfIndex)
+	}
+}
+
+func TestNetwork_CapturesProbesAndReplies(t *testing.T) {
+	file, _ := ioutil.TempFile("", "capture")
+	file.Close()
+	defer os.Remove(file.Name())
+	capture, err := probe.NewCaptureWriter(file.Name())
+	assert.Nil(t, err)
+	probe.UseCapture(capture)
+	defer probe.UseCapture(nil)
+
+	network := NewNetwork(1)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2")})
+	assert.Len(t, found, 1)
+	assert.Nil(t, capture.Close())
+
+	// Two probes and one reply, each a 40 byte IPv6 header and 24 byte echo message
+	content, _ := ioutil.ReadFile(file.Name())
+	assert.Len(t, content, 24 + 3 * (16 + 40 + 24))
+}
+
+func TestNetwork_ReplayedCaptureMatchesScan(t *testing.T) {
+	file, _ := ioutil.TempFile("", "replay")
+	file.Close()
+	defer os.Remove(file.Name())
+	capture, _ := probe.NewCaptureWriter(file.Name())
+	probe.UseCapture(capture)
+
+	network := NewNetwork(1)
+	_, aliased, _ := net.ParseCIDR("2001:db8:1::/48")
+	_, unreachable, _ := net.ParseCIDR("2001:db8:2::/48")
+	network.AddAliasedNetwork(aliased)
+	network.AddUnreachableNetwork(unreachable, getTestingIP("2001:db8::ffff"), 3)
+	addrs := append(addressing.GenerateRandomAddressesInNetwork(aliased, 10), addressing.GenerateRandomAddressesInNetwork(unreachable, 5)...)
+	addrs = append(addrs, getTestingIP("2001:db8:3::1"))
+	scanned := probeNetwork(network, addrs)
+	probe.UseCapture(nil)
+	capture.Close()
+
+	replayed, err := probe.ReadResultsFromCapture(file.Name(), probe.PHASE_GENERATE)
+	assert.Nil(t, err)
+	assert.Len(t, replayed, len(scanned))
+	replies, errors := 0, 0
+	for _, result := range replayed {
+		if result.IsError() {
+			errors++
+			assert.True(t, unreachable.Contains(*result.Target))
+			assert.Equal(t, "2001:db8::ffff", result.Addr.String())
+		} else {
+			replies++
+			assert.True(t, aliased.Contains(*result.Addr))
+		}
+		assert.False(t, result.SentAt.IsZero())
+		assert.True(t, result.GetRTT() >= 0)
+	}
+	assert.Equal(t, 10, replies)
+	assert.Equal(t, 5, errors)
+}
+
+func TestNetwork_TraceFindsRoutersAndPaths(t *testing.T) {
+	network := NewNetwork(1)
+	_, routed, _ := net.ParseCIDR("2001:db8:1::/48")
+	routers := []*net.IP{getTestingIP("2001:db8::a"), getTestingIP("2001:db8::b"), getTestingIP("2001:db8::c")}
+	network.AddRoute(routed, routers)
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8:1::1")})
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	routersFile, _ := ioutil.TempFile("", "routers")
+	routersFile.Close()
+	defer os.Remove(routersFile.Name())
+	pathsFile, _ := ioutil.TempFile("", "paths")
+	pathsFile.Close()
+	defer os.Remove(pathsFile.Name())
+
+	targets := []*net.IP{getTestingIP("2001:db8:1::1"), getTestingIP("2001:db8:1::2")}
+	paths, err := pingscan.Trace(targets, routersFile.Name(), pathsFile.Name(), 6, "1G", &pingscan.Order{Seed: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 12, network.GetTotalProbeCount())
+
+	found, _ := ioutil.ReadFile(routersFile.Name())
+	assert.Equal(t, "2001:db8::a\n2001:db8::b\n2001:db8::c\n", string(found))
+	written, _ := ioutil.ReadFile(pathsFile.Name())
+	assert.Equal(t, 2, strings.Count(string(written), "\n"))
+
+	traced := paths.GetPaths()
+	assert.Len(t, traced, 2)
+	assert.True(t, traced[0].Reached)
+	assert.Len(t, traced[0].Hops, 4)
+	assert.Equal(t, "2001:db8::c", traced[0].Hops[2].Addr)
+	assert.Equal(t, 4, traced[0].Hops[3].HopLimit)
+	assert.False(t, traced[1].Reached)
+	assert.Len(t, traced[1].Hops, 3)
+}
+
+func TestNetwork_TCPProbesFindHostsThatIgnorePings(t *testing.T) {
+	viper.Set("PingScanProbe", "tcp")
+	viper.Set("PingScanTCPPorts", "22,80")
+	defer viper.Set("PingScanProbe", "icmp")
+	defer viper.Set("PingScanTCPPorts", "22,80,443")
+	network := NewNetwork(1)
+	network.AddTCPHosts([]*net.IP{getTestingIP("2001:db8::1")}, []int{80})
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::2")})
+	results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+	assert.Len(t, results, 2)
+	assert.EqualValues(t, 4, network.GetTotalProbeCount() - network.GetProbeCount(getTestingIP("2001:db8::3")))
+	for _, result := range results {
+		assert.False(t, result.IsError())
+		assert.True(t, result.GetRTT() >= 0)
+		if result.Target.String() == "2001:db8::2" {
+			assert.Equal(t, probe.TCP_RST, result.Type)
+		}
+	}
+}
+
+func TestNetwork_BothProbesReportEachHostOnce(t *testing.T) {
+	viper.Set("PingScanProbe", "both")
+	defer viper.Set("PingScanProbe", "icmp")
+	network := NewNetwork(1)
+	network.AddTCPHosts([]*net.IP{getTestingIP("2001:db8::1")}, []int{443})
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::2")})
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+	assert.Len(t, found, 2)
+	assert.EqualValues(t, 4, network.GetProbeCount(getTestingIP("2001:db8::1")))
+}
+
+func TestNetwork_UDPProbesFindServicesAndClosedPorts(t *testing.T) {
+	viper.Set("PingScanProbe", "udp")
+	defer viper.Set("PingScanProbe", "icmp")
+	defer viper.Set("PingScanUDPPorts", "53,123,161")
+	for _, port := range []int{53, 123, 161} {
+		viper.Set("PingScanUDPPorts", strconv.Itoa(port))
+		network := NewNetwork(1)
+		network.AddUDPHosts([]*net.IP{getTestingIP("2001:db8::1")}, []int{port})
+		network.AddHosts([]*net.IP{getTestingIP("2001:db8::2")})
+		results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+		assert.Len(t, results, 2, "port %d", port)
+		for _, result := range results {
+			assert.False(t, result.IsError())
+			assert.Equal(t, port, result.Port)
+			if result.Target.String() == "2001:db8::1" {
+				assert.Equal(t, probe.UDP_REPLY, result.Type, "port %d", port)
+			} else {
+				assert.Equal(t, probe.PORT_UNREACHABLE, result.Type, "port %d", port)
+			}
+		}
+	}
+}
+
+func TestNetwork_ErrorsForTCPProbesAreLinkedToTargets(t *testing.T) {
+	viper.Set("PingScanProbe", "tcp")
+	viper.Set("PingScanTCPPorts", "443")
+	defer viper.Set("PingScanProbe", "icmp")
+	defer viper.Set("PingScanTCPPorts", "22,80,443")
+	network := NewNetwork(1)
+	_, unreachable, _ := net.ParseCIDR("2001:db8:1::/48")
+	network.AddUnreachableNetwork(unreachable, getTestingIP("2001:db8::ffff"), 1)
+	results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8:1::1")})
+	assert.Len(t, results, 1)
+	assert.Equal(t, probe.DESTINATION_UNREACHABLE, results[0].Type)
+	assert.Equal(t, "2001:db8:1::1", results[0].Target.String())
+	assert.Equal(t, 443, results[0].Port)
+}
+
+func TestNetwork_ParamProbesFindHostsThatFilterPings(t *testing.T) {
+	viper.Set("PingScanProbe", "param")
+	defer viper.Set("PingScanProbe", "icmp")
+	network := NewNetwork(1)
+	network.AddEchoFilteringHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::2")})
+	results := probeNetwork(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+	assert.Len(t, results, 2)
+	for _, result := range results {
+		assert.Equal(t, probe.PARAMETER_PROBLEM, result.Type)
+		assert.Equal(t, 2, result.Code)
+		assert.False(t, result.IsError())
+		assert.Equal(t, result.Target.String(), result.Addr.String())
+		assert.True(t, result.GetRTT() >= 0)
+	}
+}
+
+func TestNetwork_AnswersAreCountedPerProbeType(t *testing.T) {
+	viper.Set("PingScanProbe", "icmp,param")
+	defer viper.Set("PingScanProbe", "icmp")
+	echoCount := metrics.Get("probe.answered.echo_reply.count").(metrics.Counter)
+	paramCount := metrics.Get("probe.answered.parameter_problem.count").(metrics.Counter)
+	echoBefore, paramBefore := echoCount.Count(), paramCount.Count()
+	network := NewNetwork(1)
+	network.AddEchoFilteringHosts([]*net.IP{getTestingIP("2001:db8::1")})
+	network.AddHosts([]*net.IP{getTestingIP("2001:db8::2")})
+	found := probeAddresses(network, []*net.IP{getTestingIP("2001:db8::1"), getTestingIP("2001:db8::2"), getTestingIP("2001:db8::3")})
+	assert.Len(t, found, 2)
+	assert.EqualValues(t, 1, echoCount.Count() - echoBefore)
+	assert.EqualValues(t, 2, paramCount.Count() - paramBefore)
+}
+
+func getLoopbackInterface(t *testing.T) *net.Interface {
+	ifaces, err := net.Interfaces()
+	assert.Nil(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags & net.FlagLoopback != 0 {
+			return &iface
+		}
+	}
+	t.Skip("no loopback interface to bind a local scan to")
+	return nil
+}
+
+func TestNetwork_LocalScanFindsLinkHostsAndRouters(t *testing.T) {
+	iface := getLoopbackInterface(t)
+	network := NewNetwork(1)
+	network.AddLinkHosts([]*net.IP{getTestingIP("fe80::1"), getTestingIP("2001:db8:1::10"), getTestingIP("2001:db8:2::10")})
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/64")
+	network.AddAdvertisingRouter(getTestingIP("fe80::ffff"), prefix, iface.Index)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	scanner, err := probe.NewLocalScanner(iface.Name, "1G", 50 * time.Millisecond)
+	assert.Nil(t, err)
+	var solicitedIn []string
+	results, err := scanner.Scan(func(prefix *net.IPNet) ([]*net.IP, error) {
+		solicitedIn = append(solicitedIn, prefix.String())
+		return []*net.IP{getTestingIP("2001:db8:1::10"), getTestingIP("2001:db8:1::11")}, nil
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, solicitedIn, "2001:db8:1::/64")
+
+	found := make(map[string]probe.ResultType)
+	for _, result := range results {
+		assert.Equal(t, probe.PHASE_LOCAL, result.Phase)
+		assert.False(t, result.IsError())
+		found[result.Target.String()] = result.Type
+	}
+	assert.Equal(t, map[string]probe.ResultType{
+		"fe80::1":			probe.ECHO_REPLY,
+		"fe80::ffff":		probe.ROUTER_ADVERTISEMENT,
+		"2001:db8:1::10":	probe.NEIGHBOR_ADVERTISEMENT,
+	}, found)
+}
+
+func TestNetwork_LocalScanRequiresInterface(t *testing.T) {
+	_, err := probe.NewLocalScanner("", "1G", 50 * time.Millisecond)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,48 @@
+package simnet
+
+// Build the reply that a server on the given UDP port would send to a request, echoing back the
+// fields of the request that clients match replies up by
+func getServiceReply(port int, request []byte) ([]byte, bool) {
+	switch port {
+	case 53:
+
+		// DNS - the query itself with the response bit set
+		if len(request) < 12 {
+			return nil, false
+		}
+		reply := make([]byte, len(request))
+		copy(reply, request)
+		reply[2] |= 0x80
+		return reply, true
+	case 123:
+
+		// NTP - a server response whose origin timestamp is the request's transmit timestamp
+		if len(request) < 48 {
+			return nil, false
+		}
+		reply := make([]byte, 48)
+		reply[0] = 4 << 3 | 4
+		reply[1] = 2
+		copy(reply[24:32], request[40:48])
+		return reply, true
+	case 161:
+
+		// SNMP - the GetRequest turned into a Response by changing its PDU type (skipping over the
+		// message header, version, and community, all of which have short-form lengths)
+		offset := 2
+		for i := 0; i < 2; i++ {
+			if len(request) < offset + 2 {
+				return nil, false
+			}
+			offset += 2 + int(request[offset + 1])
+		}
+		if len(request) <= offset || request[0] != 0x30 || request[offset] != 0xa0 {
+			return nil, false
+		}
+		reply := make([]byte, len(request))
+		copy(reply, request)
+		reply[offset] = 0xa2
+		return reply, true
+	}
+	return nil, false
+}
@@ -36,38 +36,76 @@ func init() {
 
 func generateCandidateAddresses() error {
 
-	// Load the statistical model, blacklist, and bloom filter
+	// Generate all of the addresses
 
-	model, err := data.GetProbabilisticClusterModel()
+	bloom, err := data.GetBloomFilter()
 	if err != nil {
 		return err
 	}
-	blacklist, err := data.GetBlacklist()
+	var addresses []*net.IP
+	bloom, err = generateCandidates(
+		viper.GetInt("GenerateAddressCount"),
+		bloom,
+		func(addr *net.IP) error {
+			addresses = append(addresses, addr)
+			return nil
+		},
+		func() ([]*net.IP, error) {
+			return addresses, nil
+		},
+	)
 	if err != nil {
 		return err
 	}
-	bloom, err := data.GetBloomFilter()
+
+	// Write addresses and Bloom filter to disk and update data manager to point to in-memory references
+
+	outputPath := fs.GetTimedFilePath(config.GetCandidateAddressDirPath())
+	logging.Debugf("Writing results of candidate address generation to file at '%s'.", outputPath)
+	start := time.Now()
+	err = addressing.WriteIPsToHexFile(outputPath, addresses)
 	if err != nil {
 		return err
 	}
+	elapsed := time.Since(start)
+	generateWriteTimer.Update(elapsed)
+	logging.Debugf("It took a total of %s to write %d addresses to file.", elapsed, len(addresses))
+	return writeBloomFilter(bloom)
+
+}
+
+// Generate count candidate addresses from the cluster model, passing each address that is neither
+// blacklisted nor already in the Bloom filter to emit. existing is called to retrieve the addresses
+// generated so far whenever the Bloom filter has to be remade. Returns the updated Bloom filter.
+func generateCandidates(count int, bloom *bloom2.BloomFilter, emit func(*net.IP) error, existing func() ([]*net.IP, error)) (*bloom2.BloomFilter, error) {
+
+	// Load the statistical model and blacklist
+
+	model, err := data.GetProbabilisticClusterModel()
+	if err != nil {
+		return nil, err
+	}
+	blacklist, err := data.GetBlacklist()
+	if err != nil {
+		return nil, err
+	}
 	targetNetwork, err := config.GetTargetNetwork()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if blacklist.IsNetworkBlacklisted(targetNetwork) {
 		blacklistNet := blacklist.GetBlacklistingNetworkFromNetwork(targetNetwork)
-		return errors.New(fmt.Sprintf("The target network range (%s) is blaclisted (blacklisting network of %s).", targetNetwork, blacklistNet))
+		return nil, errors.New(fmt.Sprintf("The target network range (%s) is blaclisted (blacklisting network of %s).", targetNetwork, blacklistNet))
 	}
 
 	// Generate all of the addresses and filter out based on Bloom filter and blacklist
 
 	logging.Infof(
 		"Generating a total of %d addresses based on the content of cluster model. Network range is %s.",
-		viper.GetInt("GenerateAddressCount"),
+		count,
 		targetNetwork,
 	)
-	var addresses []*net.IP
 	var blacklistCount, totalBloomCount, curBloomCount, madeCount = 0, 0, 0, 0
 	var bloomEmptyThreshold = int(viper.GetFloat64("BloomEmptyMultiple") * float64(viper.GetInt("GenerateAddressCount")))
 
@@ -91,6 +129,11 @@ func generateCandidateAddresses() error {
 		}
 		if curBloomCount >= bloomEmptyThreshold {
 			logging.Infof("Bloom filter rejection rate currently exceeds threshold of %d (%d rejected). Emptying and recreating.", bloomEmptyThreshold, curBloomCount)
+			addresses, err := existing()
+			if err != nil {
+				logging.Warnf("Error thrown when retrieving generated addresses: %e", err)
+				return false, err
+			}
 			bloom, err = remakeBloomFilter(addresses)
 			if err != nil {
 				logging.Warnf("Error thrown when remaking Bloom filter: %e", err)
@@ -103,47 +146,34 @@ func generateCandidateAddresses() error {
 	}
 
 	start := time.Now()
-	targetNetwork, err = config.GetTargetNetwork()
-	if err != nil {
-		logging.Warnf("Error thrown when getting target network from config: %e", err)
-		return err
-	}
-	addresses, err = model.GenerateAddressesFromNetworkWithCallback(viper.GetInt("GenerateAddressCount"), viper.GetFloat64("ModelGenerationJitter"), targetNetwork, addrProcessFunc)
+	err = model.StreamAddressesFromNetwork(count, viper.GetFloat64("ModelGenerationJitter"), targetNetwork, addrProcessFunc, emit)
 	if err != nil {
 		logging.Warnf("Error thrown when generating multiple IP addresses for network %s: %e", targetNetwork, err)
-		return err
+		return nil, err
 	}
 	elapsed := time.Since(start)
 	generateDurationTimer.Update(elapsed)
 	generateBlacklistCount.Inc(int64(blacklistCount))
 	generateBloomCount.Inc(int64(totalBloomCount))
-	logging.Infof("Took a total of %s to generate %d candidate addresses (%d blacklisted filtered out, %d existed in Bloom filter).", elapsed, viper.GetInt("GenerateAddressCount"), blacklistCount, totalBloomCount)
+	logging.Infof("Took a total of %s to generate %d candidate addresses (%d blacklisted filtered out, %d existed in Bloom filter).", elapsed, count, blacklistCount, totalBloomCount)
+	return bloom, nil
 
-	// Write addresses and Bloom filter to disk and update data manager to point to in-memory references
+}
 
-	outputPath := fs.GetTimedFilePath(config.GetCandidateAddressDirPath())
-	logging.Debugf("Writing results of candidate address generation to file at '%s'.", outputPath)
-	start = time.Now()
-	err = addressing.WriteIPsToHexFile(outputPath, addresses)
-	if err != nil {
-		return err
-	}
-	elapsed = time.Since(start)
-	generateWriteTimer.Update(elapsed)
-	logging.Debugf("It took a total of %s to write %d addresses to file.", elapsed, len(addresses))
-	outputPath = fs.GetTimedFilePath(config.GetBloomDirPath())
+// Write the Bloom filter to disk and update data manager to point to the in-memory reference
+func writeBloomFilter(bloom *bloom2.BloomFilter) error {
+	outputPath := fs.GetTimedFilePath(config.GetBloomDirPath())
 	logging.Debugf("Writing current state of Bloom filter to file at '%s'.", outputPath)
-	start = time.Now()
-	err = filtering.WriteBloomFilterToFile(outputPath, bloom)
+	start := time.Now()
+	err := filtering.WriteBloomFilterToFile(outputPath, bloom)
 	if err != nil {
 		return err
 	}
-	elapsed = time.Since(start)
+	elapsed := time.Since(start)
 	bloomWriteTimer.Update(elapsed)
 	data.UpdateBloomFilter(bloom, outputPath)
 	logging.Debugf("It took a total of %s to write Bloom filter to file '%s'.", elapsed, outputPath)
 	return nil
-
 }
 
 func remakeBloomFilter(existingAddrs []*net.IP) (*bloom2.BloomFilter, error) {
@@ -10,6 +10,7 @@ import (
 	"github.com/lavalamp-/ipv666/internal/fs"
 	"github.com/lavalamp-/ipv666/internal/logging"
 	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
 	"net"
@@ -152,7 +153,6 @@ func findAliasedNetworksFromSeekPairs(seekPairs []*seekPair) ([]*net.IPNet, erro
 }
 
 func aliasSeekLoop(acs *blacklist.AliasCheckStates) error {
-	//TODO delete files after the function is finished?
 	var i int
 	start := time.Now()
 	logging.Debug("Generating test addresses...")
@@ -167,26 +167,16 @@ func aliasSeekLoop(acs *blacklist.AliasCheckStates) error {
 			scanAddrs = append(scanAddrs, testAddr)
 		}
 	}
-	targetsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
-	logging.Debugf("Writing %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-	err := addressing.WriteIPsToHexFile(targetsPath, scanAddrs)
+	logging.Debugf("Kicking off ping scan of %d blacklist scan addresses.", len(scanAddrs))
+	prober, err := probe.NewFromConfig(probe.PHASE_ALIAS)
 	if err != nil {
-		logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(scanAddrs), targetsPath, err)
 		return err
 	}
-	logging.Debugf("Successfully wrote %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
-	logging.Debugf("Kicking off ping scan from file path '%s' to output path '%s'.", targetsPath, outputPath)
-	_, err = pingscan.ScanFromConfig(targetsPath, outputPath)
+	foundAddrs, err := probe.ProbeAddresses(prober, scanAddrs)
 	if err != nil {
 		logging.Warnf("An error was thrown when running ping scan: %s", err)
 		return err
 	}
-	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
-	if err != nil {
-		logging.Warnf("Error thrown when reading IP addresses from file '%s': %e", outputPath, err)
-		return err
-	}
 	logging.Debugf("%d addresses responded to ICMP pings.", len(foundAddrs))
 	foundAddrSet := addressing.GetIPSet(foundAddrs)
 	logging.Debugf("Updating check list with results from Zmap scan.")
@@ -206,15 +196,16 @@ func checkNetworksForAliased(nets []*net.IPNet) ([]*seekPair, error) {
 	}
 
 	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
+	errorPath := fs.GetTimedFilePath(config.GetPingErrorDirPath())
 	logging.Debugf("Ping scanning alias candidates in file '%s'. Results will be written to '%s'.", candsPath, outputPath)
 
-	_, err = pingscan.ScanFromConfig(candsPath, outputPath)
+	_, err = pingscan.ScanFromConfig(probe.PHASE_ALIAS, candsPath, outputPath, errorPath)
 	if err != nil {
 		return nil, err
 	}
 	logging.Infof("Successfully scanned alias candidates to file '%s'.", outputPath)
 
-	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
+	foundAddrs, err := probe.ReadLiveAddrsFromRecordFile(outputPath)
 	if err != nil {
 		return nil, err
 	}
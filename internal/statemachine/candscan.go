@@ -6,6 +6,7 @@ import (
 	"github.com/lavalamp-/ipv666/internal/fs"
 	"github.com/lavalamp-/ipv666/internal/logging"
 	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
 	"time"
@@ -26,14 +27,43 @@ func pingScanCandidateAddresses() error {
 	if err != nil {
 		return err
 	}
-	outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
+
+	// Pick up where an interrupted scan of the same candidates left off
+	checkpointPath := config.GetScanCheckpointFilePath()
+	order := pingscan.GetOrderFromConfig()
+	checkpoint, err := pingscan.ReadCheckpoint(checkpointPath)
+	if err != nil {
+		logging.Warnf("Error thrown when reading scan checkpoint at '%s', starting scan from the beginning: %s", checkpointPath, err)
+		checkpoint = nil
+	}
+	if checkpoint != nil && !checkpoint.Pipelined && checkpoint.Matches(inputPath, viper.GetInt64("PingScanSeed")) {
+		logging.Infof("Resuming interrupted ping-scan of '%s' from position %d.", inputPath, checkpoint.Position)
+		order.Seed = checkpoint.Seed
+		order.Start = checkpoint.Position
+	} else {
+		checkpoint = &pingscan.Checkpoint{
+			InputPath:		inputPath,
+			OutputPath:		fs.GetTimedFilePath(config.GetPingResultDirPath()),
+			ErrorPath:		fs.GetTimedFilePath(config.GetPingErrorDirPath()),
+			Seed:			order.Seed,
+		}
+	}
+	order.Checkpoint = func(position uint64) {
+		checkpoint.Position = position
+		if err := pingscan.WriteCheckpoint(checkpointPath, checkpoint); err != nil {
+			logging.Warnf("Error thrown when writing scan checkpoint to '%s': %s", checkpointPath, err)
+		}
+	}
+
+	outputPath := checkpoint.OutputPath
 	logging.Infof(
-		"Now ping-scanning IPv6 addressing found in file at path '%s'. Results will be written to '%s'.",
+		"Now ping-scanning IPv6 addressing found in file at path '%s'. Results will be written to '%s' and errors to '%s'.",
 		inputPath,
 		outputPath,
+		checkpoint.ErrorPath,
 	)
 	start := time.Now()
-	_, err = pingscan.ScanFromConfig(inputPath, outputPath)
+	_, err = pingscan.Scan(probe.PHASE_GENERATE, inputPath, outputPath, checkpoint.ErrorPath, viper.GetString("PingScanBandwidth"), order)
 	elapsed := time.Since(start)
 	if err != nil {
 		pingscanCandErrorCounter.Inc(1)
@@ -41,6 +71,9 @@ func pingScanCandidateAddresses() error {
 		logging.Debugf("Ping-scan elapsed time was %s.", elapsed)
 		return err
 	}
+	if err := pingscan.RemoveCheckpoint(checkpointPath); err != nil {
+		logging.Warnf("Error thrown when removing scan checkpoint at '%s': %s", checkpointPath, err)
+	}
 	pingscanCandDurationTimer.Update(elapsed)
 	liveCount, err := fs.CountLinesInFile(outputPath)
 	if err != nil {
@@ -0,0 +1,48 @@
+package statemachine
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/spf13/viper"
+)
+
+// Whether or not the given state sends probes
+func isScanningState(state State) bool {
+	switch state {
+	case GEN_ADDRESSES:
+		return isPipelineEnabled()
+	case CLEAN_UP, EMIT_METRICS:
+		return false
+	}
+	return true
+}
+
+// Start writing the packets that are sent and received during the given state to a new pcap file,
+// returning nil if packet capture is disabled or the state doesn't send probes
+func startStateCapture(state State) (*probe.CaptureWriter, error) {
+	if !viper.GetBool("PacketCaptureEnabled") || !isScanningState(state) {
+		return nil, nil
+	}
+	filePath := fs.GetTimedFilePath(config.GetPacketCaptureDirPath()) + ".pcap"
+	capture, err := probe.NewCaptureWriter(filePath)
+	if err != nil {
+		return nil, err
+	}
+	probe.UseCapture(capture)
+	logging.Infof("Capturing packets sent and received in state %d to '%s'.", state, filePath)
+	return capture, nil
+}
+
+func stopStateCapture(capture *probe.CaptureWriter) {
+	if capture == nil {
+		return
+	}
+	probe.UseCapture(nil)
+	if err := capture.Close(); err != nil {
+		logging.Warnf("Error thrown when closing packet capture (path '%s'): %s", capture.GetFilePath(), err)
+		return
+	}
+	logging.Debugf("Captured %d packets to '%s'.", capture.GetPacketCount(), capture.GetFilePath())
+}
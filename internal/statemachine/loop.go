@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/lavalamp-/ipv666/internal/config"
 	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
 	"io/ioutil"
@@ -101,6 +102,14 @@ func postScanCleanup() error {
 	return nil
 }
 
+func getNextState(state State) State {
+	if state == GEN_ADDRESSES && isPipelineEnabled() {
+		// Candidates were already scanned as they were generated
+		return PING_SCAN_ALIAS_REMOVAL
+	}
+	return (state + 1) % (LAST_STATE + 1)
+}
+
 func SetStateFile(filePath string, curState State) error {
 	logging.Debugf("Now updating state file at path '%s' with current state of %d.", filePath, curState)
 	var b []byte
@@ -117,6 +126,11 @@ func InitStateFile(filePath string) error {
 }
 
 func RunStateMachine() error {
+	return runStateMachine(-1)
+}
+
+// Run the state machine for the given number of state transitions (or forever if negative)
+func runStateMachine(transitions int) error {
 
 	logging.Infof("Now starting to run the state machine.")
 
@@ -128,17 +142,36 @@ func RunStateMachine() error {
 
 	logging.Debugf("Starting at state %d.", state)
 
-	for {
+	// Make sure that the capture of a state that fails is still written out
+	var capture *probe.CaptureWriter
+	defer func() {
+		stopStateCapture(capture)
+	}()
+
+	for i := 0; transitions < 0 || i < transitions; i++ {
 
 		logging.Debugf("Now entering state %d.", state)
 		start := time.Now()
 
+		capture, err = startStateCapture(state)
+		if err != nil {
+			return err
+		}
+
 		switch state {
 		case GEN_ADDRESSES:
-			// Generate the candidate addressing to scan from the most recent model
-			err := generateCandidateAddresses()
-			if err != nil {
-				return err
+			if isPipelineEnabled() {
+				// Generate the candidate addressing from the most recent model and scan them as they're generated
+				err := generateAndScanCandidates()
+				if err != nil {
+					return err
+				}
+			} else {
+				// Generate the candidate addressing to scan from the most recent model
+				err := generateCandidateAddresses()
+				if err != nil {
+					return err
+				}
 			}
 		case PING_SCAN_ADDR:
 			// Perform a ping scan of the candidate addressing that were generated
@@ -191,6 +224,9 @@ func RunStateMachine() error {
 			// Emit metrics
 		}
 
+		stopStateCapture(capture)
+		capture = nil
+
 		elapsed := time.Since(start)
 		logging.Debugf("Completed state %d (took %s).", state, elapsed)
 
@@ -203,10 +239,12 @@ func RunStateMachine() error {
 		}
 		timer.Update(elapsed)
 
-		state = (state + 1) % (LAST_STATE + 1)
+		state = getNextState(state)
 		err = SetStateFile(config.GetStateFilePath(), state)
 		if err != nil {
 			return err
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,226 @@
+package statemachine
+
+import (
+	"github.com/lavalamp-/ipv666/internal/addressing"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/lavalamp-/ipv666/internal/simnet"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setUpSimulatedRun(t *testing.T) string {
+	config.InitConfig()
+	baseDir, err := ioutil.TempDir("", "ipv666")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("BaseOutputDirectory", baseDir)
+	viper.Set("OutputFileName", filepath.Join(baseDir, "discovered_addrs"))
+	viper.Set("LogLevel", "error")
+	viper.Set("ScanTargetNetwork", "2001:db8::/32")
+	viper.Set("GenerateAddressCount", 1000)
+	viper.Set("AddressFilterSize", 100000)
+	viper.Set("PingScanBandwidth", "1G")
+	viper.Set("PingScanDrainTimeout", 0.1)
+	viper.Set("PingScanRetryTimeout", 0.1)
+	viper.Set("PingScanPrefixRate", 0)
+	viper.Set("FanOutNetworkBlockSize", 4)
+	viper.Set("FanOutHostBlockSize", 4)
+	for _, dirPath := range config.GetAllDirectories() {
+		if err := fs.CreateDirectoryIfNotExist(dirPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitStateFile(config.GetStateFilePath()); err != nil {
+		t.Fatal(err)
+	}
+	return baseDir
+}
+
+func getNybbleAdjacentIP(ip *net.IP, index int) *net.IP {
+	nybbles := addressing.GetNybblesFromIP(ip, 32)
+	nybbles[index] = (nybbles[index] + 1) % 16
+	return addressing.NybblesToIP(nybbles)
+}
+
+func TestRunStateMachine_SimulatedDiscoverLoop(t *testing.T) {
+	baseDir := setUpSimulatedRun(t)
+	defer os.RemoveAll(baseDir)
+
+	// Generate candidates and then build a population around them
+	err := generateCandidateAddresses()
+	assert.Nil(t, err)
+	candsPath, err := data.GetMostRecentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	cands, err := fs.ReadIPsFromHexFile(candsPath)
+	assert.Nil(t, err)
+	assert.True(t, len(cands) > 20)
+
+	aliasedAddr := cands[0]
+	aliasedNet, _ := addressing.GetIPv6NetworkFromBytes(*aliasedAddr, 64)
+	var hosts []*net.IP
+	for _, cand := range cands[1:] {
+		if len(hosts) < 10 && !aliasedNet.Contains(*cand) {
+			hosts = append(hosts, cand)
+		}
+	}
+	adjacent := getNybbleAdjacentIP(hosts[0], 20)
+
+	network := simnet.NewNetwork(1)
+	network.AddHosts(hosts)
+	network.AddHosts([]*net.IP{adjacent})
+	network.AddAliasedNetwork(aliasedNet)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// Run the remainder of the loop
+	err = SetStateFile(config.GetStateFilePath(), PING_SCAN_ADDR)
+	assert.Nil(t, err)
+	err = runStateMachine(int(LAST_STATE - PING_SCAN_ADDR) + 1)
+	assert.Nil(t, err)
+
+	state, err := fetchStateFromFile(config.GetStateFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, FIRST_STATE, state)
+
+	// Live hosts and those found through fan-out are in the output, aliased addresses are not
+	found, err := fs.ReadIPsFromHexFile(config.GetOutputFilePath())
+	assert.Nil(t, err)
+	foundSet := addressing.GetIPSet(found)
+	for _, host := range hosts {
+		assert.Contains(t, foundSet, host.String())
+	}
+	assert.Contains(t, foundSet, adjacent.String())
+	for _, addr := range found {
+		assert.False(t, aliasedNet.Contains(*addr))
+	}
+
+	// The aliased network was found and blacklisted
+	blacklist, err := data.GetBlacklist()
+	assert.Nil(t, err)
+	assert.True(t, blacklist.IsIPBlacklisted(aliasedAddr))
+	blacklistNet := blacklist.GetBlacklistingNetworkFromIP(aliasedAddr)
+	assert.Equal(t, aliasedNet.String(), blacklistNet.String())
+}
+
+func TestRunStateMachine_SimulatedPipeline(t *testing.T) {
+	baseDir := setUpSimulatedRun(t)
+	defer os.RemoveAll(baseDir)
+	viper.Set("PipelineGenerateScan", true)
+	defer viper.Set("PipelineGenerateScan", false)
+
+	network := simnet.NewNetwork(1)
+	targetNetwork, _ := config.GetTargetNetwork()
+	network.AddAliasedNetwork(targetNetwork)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// Generating candidates also scans them and skips the standalone scan state
+	err := runStateMachine(1)
+	assert.Nil(t, err)
+	state, err := fetchStateFromFile(config.GetStateFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, PING_SCAN_ALIAS_REMOVAL, state)
+
+	// Every candidate was written to disk and probed exactly once
+	candsPath, err := data.GetMostRecentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	cands, err := fs.ReadIPsFromHexFile(candsPath)
+	assert.Nil(t, err)
+	assert.Len(t, cands, viper.GetInt("GenerateAddressCount"))
+	found, err := data.GetCandidatePingResults()
+	assert.Nil(t, err)
+	assert.Len(t, found, viper.GetInt("GenerateAddressCount"))
+	assert.Equal(t, len(found), network.GetTotalProbeCount())
+	for _, addr := range found {
+		assert.Equal(t, 1, network.GetProbeCount(addr))
+	}
+}
+
+func TestRunStateMachine_ResumesSimulatedPipeline(t *testing.T) {
+	baseDir := setUpSimulatedRun(t)
+	defer os.RemoveAll(baseDir)
+	viper.Set("PipelineGenerateScan", true)
+	defer viper.Set("PipelineGenerateScan", false)
+
+	network := simnet.NewNetwork(1)
+	targetNetwork, _ := config.GetTargetNetwork()
+	network.AddAliasedNetwork(targetNetwork)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// Leave behind the candidates and checkpoint of a run interrupted partway through writing a candidate
+	viper.Set("GenerateAddressCount", 600)
+	err := generateCandidateAddresses()
+	assert.Nil(t, err)
+	viper.Set("GenerateAddressCount", 1000)
+	candsPath, err := data.GetMostRecentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	interrupted, err := fs.ReadIPsFromHexFile(candsPath)
+	assert.Nil(t, err)
+	candsFile, err := os.OpenFile(candsPath, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = candsFile.WriteString("2001:db8:")
+	assert.Nil(t, err)
+	candsFile.Close()
+	err = pingscan.WriteCheckpoint(config.GetScanCheckpointFilePath(), &pingscan.Checkpoint{
+		InputPath:		candsPath,
+		OutputPath:		fs.GetTimedFilePath(config.GetPingResultDirPath()),
+		ErrorPath:		fs.GetTimedFilePath(config.GetPingErrorDirPath()),
+		Position:		200,
+		Pipelined:		true,
+	})
+	assert.Nil(t, err)
+
+	err = runStateMachine(1)
+	assert.Nil(t, err)
+	state, err := fetchStateFromFile(config.GetStateFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, PING_SCAN_ALIAS_REMOVAL, state)
+
+	// The rest of the candidates were appended to the same file and only those past the checkpoint were probed
+	cands, err := fs.ReadIPsFromHexFile(candsPath)
+	assert.Nil(t, err)
+	assert.Len(t, cands, 1000)
+	assert.Len(t, addressing.GetIPSet(cands), 1000)
+	for _, addr := range interrupted[:200] {
+		assert.Equal(t, 0, network.GetProbeCount(addr))
+	}
+	for _, addr := range cands[200:] {
+		assert.Equal(t, 1, network.GetProbeCount(addr))
+	}
+	checkpoint, err := pingscan.ReadCheckpoint(config.GetScanCheckpointFilePath())
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+}
+
+func TestRunStateMachine_CapturesScanningStates(t *testing.T) {
+	baseDir := setUpSimulatedRun(t)
+	defer os.RemoveAll(baseDir)
+	viper.Set("PacketCaptureEnabled", true)
+	defer viper.Set("PacketCaptureEnabled", false)
+
+	network := simnet.NewNetwork(1)
+	targetNetwork, _ := config.GetTargetNetwork()
+	network.AddAliasedNetwork(targetNetwork)
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+
+	// Generating candidates doesn't send any probes, so only the scan of them is captured
+	err := runStateMachine(2)
+	assert.Nil(t, err)
+	captures, err := ioutil.ReadDir(config.GetPacketCaptureDirPath())
+	assert.Nil(t, err)
+	assert.Len(t, captures, 1)
+	perPacket := int64(16 + 40 + 24)
+	assert.True(t, captures[0].Size() >= 24 + 2 * int64(viper.GetInt("GenerateAddressCount")) * perPacket)
+}
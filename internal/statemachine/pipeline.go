@@ -0,0 +1,210 @@
+package statemachine
+
+import (
+	"bufio"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of generated candidates that can be waiting to be scanned before generation blocks
+const pipelineBufferSize = 4096
+
+func isPipelineEnabled() bool {
+	return viper.GetBool("PipelineGenerateScan")
+}
+
+// Get the checkpoint of an interrupted pipelined scan of the most recent candidates, returning nil
+// if there isn't one
+func getPipelineCheckpoint(checkpointPath string) *pingscan.Checkpoint {
+	checkpoint, err := pingscan.ReadCheckpoint(checkpointPath)
+	if err != nil {
+		logging.Warnf("Error thrown when reading scan checkpoint at '%s', starting generation from the beginning: %s", checkpointPath, err)
+		return nil
+	}
+	if checkpoint == nil || !checkpoint.Pipelined {
+		return nil
+	}
+	inputPath, err := data.GetMostRecentFilePathFromDir(config.GetCandidateAddressDirPath())
+	if err != nil || inputPath != checkpoint.InputPath {
+		return nil
+	}
+	return checkpoint
+}
+
+// Pass each of the candidates in filePath to emit, returning how many there were. A partially-written
+// line left at the end of the file by an interrupted run is truncated so that the file can be appended to.
+func streamCandidates(filePath string, emit func(*net.IP)) (int, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var count int
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				logging.Warnf("Truncating partially-written candidate '%s' from the end of file '%s'.", line, filePath)
+				return count, file.Truncate(offset)
+			}
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		offset += int64(len(line))
+		addr := net.ParseIP(strings.TrimSpace(line))
+		if addr == nil {
+			continue
+		}
+		emit(&addr)
+		count++
+	}
+}
+
+// Generate candidate addresses and ping scan them as they are generated. The candidates are written
+// to disk as they are generated so that an interrupted run can be resumed from them, and only the
+// candidates that weren't scanned before the interruption are scanned again.
+func generateAndScanCandidates() error {
+
+	// Pick up where an interrupted run left off
+	checkpointPath := config.GetScanCheckpointFilePath()
+	checkpoint := getPipelineCheckpoint(checkpointPath)
+	order := &pingscan.Order{}
+	if checkpoint != nil {
+		logging.Infof("Resuming interrupted generation and ping-scan of '%s' from position %d.", checkpoint.InputPath, checkpoint.Position)
+		order.Start = checkpoint.Position
+	} else {
+		checkpoint = &pingscan.Checkpoint{
+			InputPath:		fs.GetTimedFilePath(config.GetCandidateAddressDirPath()),
+			OutputPath:		fs.GetTimedFilePath(config.GetPingResultDirPath()),
+			ErrorPath:		fs.GetTimedFilePath(config.GetPingErrorDirPath()),
+			Pipelined:		true,
+		}
+		if err := pingscan.WriteCheckpoint(checkpointPath, checkpoint); err != nil {
+			logging.Warnf("Error thrown when writing scan checkpoint to '%s': %s", checkpointPath, err)
+		}
+	}
+	candsPath := checkpoint.InputPath
+	outputPath := checkpoint.OutputPath
+	logging.Infof(
+		"Now ping-scanning candidate addresses as they are generated. Candidates will be written to '%s', results to '%s' and errors to '%s'.",
+		candsPath,
+		outputPath,
+		checkpoint.ErrorPath,
+	)
+
+	bloom, err := data.GetBloomFilter()
+	if err != nil {
+		return err
+	}
+	candsFile, err := os.OpenFile(candsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer candsFile.Close()
+
+	// The checkpoint is written from the scanner, so candidates have to be flushed to disk before any
+	// position that refers to them is
+	var candsLock sync.Mutex
+	writer := bufio.NewWriter(candsFile)
+	order.Checkpoint = func(position uint64) {
+		candsLock.Lock()
+		err := writer.Flush()
+		candsLock.Unlock()
+		if err != nil {
+			logging.Warnf("Error thrown when flushing candidates to '%s': %s", candsPath, err)
+			return
+		}
+		checkpoint.Position = position
+		if err := pingscan.WriteCheckpoint(checkpointPath, checkpoint); err != nil {
+			logging.Warnf("Error thrown when writing scan checkpoint to '%s': %s", checkpointPath, err)
+		}
+	}
+
+	// Kick off the scanner
+	targets := make(chan *net.IP, pipelineBufferSize)
+	scanErr := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := pingscan.ScanStreamFromConfig(probe.PHASE_GENERATE, targets, outputPath, checkpoint.ErrorPath, order)
+		scanErr <- err
+	}()
+
+	// Feed it the candidates from an interrupted run, which the scanner skips past up to the checkpoint,
+	// followed by however many more need to be generated
+	existingCount, genErr := streamCandidates(candsPath, func(addr *net.IP) {
+		bloom.Add(([]byte)(*addr))
+		targets <- addr
+	})
+	if remaining := viper.GetInt("GenerateAddressCount") - existingCount; genErr == nil && remaining > 0 {
+		bloom, genErr = generateCandidates(
+			remaining,
+			bloom,
+			func(addr *net.IP) error {
+				candsLock.Lock()
+				_, err := writer.WriteString(addr.String() + "\n")
+				candsLock.Unlock()
+				if err != nil {
+					return err
+				}
+				targets <- addr
+				return nil
+			},
+			func() ([]*net.IP, error) {
+				candsLock.Lock()
+				defer candsLock.Unlock()
+				if err := writer.Flush(); err != nil {
+					return nil, err
+				}
+				return fs.ReadIPsFromHexFile(candsPath)
+			},
+		)
+	}
+	close(targets)
+
+	// Wait for the scan to finish
+	err = <-scanErr
+	elapsed := time.Since(start)
+	if err != nil {
+		pingscanCandErrorCounter.Inc(1)
+		logging.Warnf("An error was thrown when trying to run ping-scan: %s", err)
+		return err
+	}
+	if genErr != nil {
+		return genErr
+	}
+	candsLock.Lock()
+	err = writer.Flush()
+	candsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := pingscan.RemoveCheckpoint(checkpointPath); err != nil {
+		logging.Warnf("Error thrown when removing scan checkpoint at '%s': %s", checkpointPath, err)
+	}
+	pingscanCandDurationTimer.Update(elapsed)
+	liveCount, err := fs.CountLinesInFile(outputPath)
+	if err != nil {
+		logging.Warnf("Error when counting lines in file '%s': %e", outputPath, err)
+		if viper.GetBool("ExitOnFailedMetrics") {
+			return err
+		}
+	}
+	liveAddrCandGauge.Update(int64(liveCount))
+	logging.Infof("Pipelined generation and ping-scan completed successfully in %s. Results written to file at '%s'.", elapsed, outputPath)
+
+	return writeBloomFilter(bloom)
+}
@@ -0,0 +1,34 @@
+package statemachine
+
+import (
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/pingscan"
+	"github.com/lavalamp-/ipv666/internal/probe"
+)
+
+// Use the traffic in a pcap file as the results of the candidate ping scan and move the state
+// machine on to the steps that process those results, so that the next run picks up from there
+func ReplayCandidateScan(capturePath string) error {
+
+	outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
+	errorPath := fs.GetTimedFilePath(config.GetPingErrorDirPath())
+	_, err := pingscan.Replay(probe.PHASE_GENERATE, capturePath, outputPath, errorPath)
+	if err != nil {
+		return err
+	}
+
+	// The replayed results stand in for any scan that was in progress
+	if err := pingscan.RemoveCheckpoint(config.GetScanCheckpointFilePath()); err != nil {
+		logging.Warnf("Error thrown when removing scan checkpoint at '%s': %s", config.GetScanCheckpointFilePath(), err)
+	}
+	liveCount, err := fs.CountLinesInFile(outputPath)
+	if err != nil {
+		return err
+	}
+	liveAddrCandGauge.Update(int64(liveCount))
+	logging.Infof("Replayed %d live addresses to file at '%s' and errors to '%s'.", liveCount, outputPath, errorPath)
+
+	return SetStateFile(config.GetStateFilePath(), PING_SCAN_ALIAS_REMOVAL)
+}
@@ -0,0 +1,50 @@
+package statemachine
+
+import (
+	"github.com/lavalamp-/ipv666/internal/addressing"
+	"github.com/lavalamp-/ipv666/internal/config"
+	"github.com/lavalamp-/ipv666/internal/data"
+	"github.com/lavalamp-/ipv666/internal/probe"
+	"github.com/lavalamp-/ipv666/internal/simnet"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayCandidateScan(t *testing.T) {
+	baseDir := setUpSimulatedRun(t)
+	defer os.RemoveAll(baseDir)
+
+	// Capture a scan of some live hosts
+	targetNetwork, _ := config.GetTargetNetwork()
+	hosts := addressing.GenerateRandomAddressesInNetwork(targetNetwork, 20)
+	network := simnet.NewNetwork(1)
+	network.AddHosts(hosts[:10])
+	probe.UseTransport(network)
+	defer probe.UseTransport(&probe.RawTransport{})
+	capturePath := filepath.Join(baseDir, "scan.pcap")
+	capture, err := probe.NewCaptureWriter(capturePath)
+	assert.Nil(t, err)
+	probe.UseCapture(capture)
+	prober, err := probe.NewFromConfig(probe.PHASE_GENERATE)
+	probe.UseCapture(nil)
+	assert.Nil(t, err)
+	_, err = probe.ProbeAddresses(prober, hosts)
+	assert.Nil(t, err)
+	assert.Nil(t, capture.Close())
+
+	// Replaying it gives the same live hosts and moves on to processing them
+	err = ReplayCandidateScan(capturePath)
+	assert.Nil(t, err)
+	found, err := data.GetCandidatePingResults()
+	assert.Nil(t, err)
+	assert.Len(t, found, 10)
+	foundSet := addressing.GetIPSet(found)
+	for _, host := range hosts[:10] {
+		assert.Contains(t, foundSet, host.String())
+	}
+	state, err := fetchStateFromFile(config.GetStateFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, PING_SCAN_ALIAS_REMOVAL, state)
+}
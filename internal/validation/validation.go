@@ -7,13 +7,11 @@ import (
 	"github.com/lavalamp-/ipv666/internal/config"
 	"github.com/lavalamp-/ipv666/internal/data"
 	"github.com/lavalamp-/ipv666/internal/fs"
+	"github.com/lavalamp-/ipv666/internal/probe"
 	"github.com/spf13/viper"
 	"net"
-	"regexp"
 )
 
-var bandwidthRegex = regexp.MustCompile(`\d{1,8}[MGK]`)
-
 func ValidateIPv6NetworkString(toParse string) error {
 	ip, targetNetwork, err := net.ParseCIDR(toParse)
 	if err != nil {
@@ -82,9 +80,45 @@ func ValidateFileExists(filePath string) error {
 }
 
 func ValidateScanBandwidth(toValidate string) error {
-	if !bandwidthRegex.Match([]byte(toValidate)) {
-		return fmt.Errorf("%s is not a valid bandwidth, expecting a number followed by K, M, or G (ex: 10M, 100K)", toValidate)
+	_, err := probe.ParseBandwidth(toValidate)
+	return err
+}
+
+func ValidateScanBinding(interfaceName string, sourceAddress string) error {
+	_, _, err := probe.ResolveBinding(interfaceName, sourceAddress)
+	return err
+}
+
+func ValidateScanRate(toValidate float64) error {
+	if toValidate < 0 {
+		return fmt.Errorf("%f is not a valid rate, expecting a number of packets per second that is zero (to use the bandwidth instead) or greater", toValidate)
 	} else {
 		return nil
 	}
 }
+
+func ValidateTraceHops(toValidate int) error {
+	if toValidate < 1 || toValidate > probe.MaxTraceHops {
+		return fmt.Errorf("%d is not a valid maximum hop count, expecting a number between 1 and %d", toValidate, probe.MaxTraceHops)
+	} else {
+		return nil
+	}
+}
+
+func ValidateScanProbe(probeType string, tcpPorts string, udpPorts string) error {
+	types, err := probe.ParseProbeType(probeType)
+	if err != nil {
+		return err
+	}
+	if types.TCP {
+		if _, err := probe.ParseTCPPorts(tcpPorts); err != nil {
+			return err
+		}
+	}
+	if types.UDP {
+		if _, err := probe.ParseUDPPorts(udpPorts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
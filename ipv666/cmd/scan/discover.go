@@ -16,10 +16,16 @@ import (
 func init() {
 	var outputFileName string
 	var outputFileType string
+	var pipeline bool
+	var capture bool
 	discoverCmd.PersistentFlags().StringVarP(&outputFileName, "output", "o", viper.GetString("OutputFileName"), "The path to the file where discovered addresses should be written.")
 	discoverCmd.PersistentFlags().StringVarP(&outputFileType, "output-type", "t", viper.GetString("OutputFileType"), "The type of output to write to the output file (txt or bin).")
+	discoverCmd.PersistentFlags().BoolVar(&pipeline, "pipeline", viper.GetBool("PipelineGenerateScan"), "Whether or not to ping scan candidate addresses as they are generated.")
+	discoverCmd.PersistentFlags().BoolVar(&capture, "pcap", viper.GetBool("PacketCaptureEnabled"), "Whether or not to write the packets sent and received in each step to a pcap file.")
 	viper.BindPFlag("OutputFileName", discoverCmd.PersistentFlags().Lookup("output"))
 	viper.BindPFlag("OutputFileType", discoverCmd.PersistentFlags().Lookup("output-type"))
+	viper.BindPFlag("PipelineGenerateScan", discoverCmd.PersistentFlags().Lookup("pipeline"))
+	viper.BindPFlag("PacketCaptureEnabled", discoverCmd.PersistentFlags().Lookup("pcap"))
 }
 
 var discoverLongDesc = strings.TrimSpace(`
@@ -0,0 +1,65 @@
+package scan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/app"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/validation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+func init() {
+	var genCount int
+	var listenTimeout float64
+	var outputFileName string
+	var outputFileType string
+	localCmd.PersistentFlags().IntVarP(&genCount, "count", "c", viper.GetInt("LocalScanGenerateCount"), "The number of candidate addresses to generate and solicit in each on-link /64 network (0 to only ping the link).")
+	localCmd.PersistentFlags().Float64Var(&listenTimeout, "listen", viper.GetFloat64("LocalScanListenTimeout"), "The number of seconds to listen for replies after pinging the link and after the last Neighbor Solicitation.")
+	localCmd.PersistentFlags().StringVarP(&outputFileName, "output", "o", viper.GetString("OutputFileName"), "The path to the file where discovered addresses should be written.")
+	localCmd.PersistentFlags().StringVarP(&outputFileType, "output-type", "t", viper.GetString("OutputFileType"), "The type of output to write to the output file (txt or bin).")
+	viper.BindPFlag("LocalScanGenerateCount", localCmd.PersistentFlags().Lookup("count"))
+	viper.BindPFlag("LocalScanListenTimeout", localCmd.PersistentFlags().Lookup("listen"))
+}
+
+var localLongDesc = strings.TrimSpace(`
+This utility finds the hosts on the link attached to an interface (given with --interface). 
+It pings the all-nodes multicast group (ff02::1), collects the Router Advertisements that 
+routers on the link send, and sends Neighbor Solicitations for candidate addresses generated 
+within each on-link /64 network (those assigned to the interface and those that routers 
+advertise). The link-local and global addresses that are found are added to the same output 
+file that 'scan discover' writes to, which can be used to build a model with 'generate model'.
+`)
+
+var localCmd = &cobra.Command{
+	Use:			"local",
+	Short:			"Discover hosts on an attached link",
+	Long:			localLongDesc,
+	PreRun: func(cmd *cobra.Command, args []string) {
+
+		// The output flags share their settings with 'scan discover', so they are only bound when
+		// this command is the one being run
+		viper.BindPFlag("OutputFileName", cmd.PersistentFlags().Lookup("output"))
+		viper.BindPFlag("OutputFileType", cmd.PersistentFlags().Lookup("output-type"))
+
+		if err := validation.ValidateOutputFileType(viper.GetString("OutputFileType")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if viper.GetString("PingScanInterface") == "" {
+			logging.ErrorStringFf("You must supply the interface that the link to scan is attached to (--interface).")
+		}
+
+		if viper.GetInt("LocalScanGenerateCount") < 0 {
+			logging.ErrorStringFf("The generate count must not be negative (got %d).", viper.GetInt("LocalScanGenerateCount"))
+		}
+
+		if viper.GetFloat64("LocalScanListenTimeout") <= 0 {
+			logging.ErrorStringFf("You must supply a listen timeout of greater than zero (got %f).", viper.GetFloat64("LocalScanListenTimeout"))
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		app.RunLocalScan(viper.GetInt("LocalScanGenerateCount"))
+	},
+}
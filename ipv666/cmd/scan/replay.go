@@ -0,0 +1,46 @@
+package scan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/app"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	var inputPath string
+	replayCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "A pcap file of the ICMPv6 traffic of a candidate ping scan.")
+	replayCmd.MarkPersistentFlagRequired("input")
+}
+
+var replayLongDesc = strings.TrimSpace(`
+This utility rebuilds the results of a candidate ping scan from a pcap file of its ICMPv6 
+traffic (such as one written by 'scan discover --pcap') instead of sending probes. The echo 
+replies and error messages in the capture are written to the same results files that a live 
+scan writes, and the next run of 'scan discover' against the same network carries on from 
+processing them.
+`)
+
+var replayCmd = &cobra.Command{
+	Use:			"replay",
+	Short:			"Rebuild candidate ping scan results from a packet capture",
+	Long:			replayLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		app.RunReplay(inputPath)
+	},
+}
@@ -12,19 +12,48 @@ import (
 
 func init() {
 	var bandwidth string
+	var rate float64
+	var adaptiveRate bool
+	var iface string
+	var source string
+	var probeType string
+	var tcpPorts string
+	var udpPorts string
 	var targetNetwork string
+	var seed int64
 	Cmd.PersistentFlags().StringVarP(&bandwidth, "bandwidth", "b", viper.GetString("PingScanBandwidth"), "The maximum bandwidth to use for ping scanning")
+	Cmd.PersistentFlags().Float64Var(&rate, "rate", viper.GetFloat64("PingScanRate"), "The maximum packets per second to use for ping scanning (overrides bandwidth if set).")
+	Cmd.PersistentFlags().BoolVar(&adaptiveRate, "adaptive-rate", viper.GetBool("PingScanAdaptiveRate"), "Whether or not to lower the scan rate when the network shows signs of congestion.")
+	Cmd.PersistentFlags().StringVar(&iface, "interface", viper.GetString("PingScanInterface"), "The network interface to send probes out of (replies received on other interfaces are ignored).")
+	Cmd.PersistentFlags().StringVar(&source, "source", viper.GetString("PingScanSourceAddress"), "The IPv6 address to send probes from.")
+	Cmd.PersistentFlags().StringVar(&probeType, "probe", viper.GetString("PingScanProbe"), "The kinds of probes to send to each address (a comma-separated list of icmp, tcp, udp, and param for echo requests that draw Parameter Problem errors, or both for icmp and tcp).")
+	Cmd.PersistentFlags().StringVar(&tcpPorts, "tcp-ports", viper.GetString("PingScanTCPPorts"), "A comma-separated list of the ports to send TCP SYN probes to.")
+	Cmd.PersistentFlags().StringVar(&udpPorts, "udp-ports", viper.GetString("PingScanUDPPorts"), "A comma-separated list of the ports to send UDP probes to (53 for DNS, 123 for NTP, and 161 for SNMP).")
 	Cmd.PersistentFlags().StringVarP(&targetNetwork, "network", "n", viper.GetString("ScanTargetNetwork"), "The IPv6 CIDR range to scan.")
+	Cmd.PersistentFlags().Int64Var(&seed, "seed", viper.GetInt64("PingScanSeed"), "The seed for the order that candidate addresses are scanned in.")
 	viper.BindPFlag("PingScanBandwidth", Cmd.PersistentFlags().Lookup("bandwidth"))
+	viper.BindPFlag("PingScanRate", Cmd.PersistentFlags().Lookup("rate"))
+	viper.BindPFlag("PingScanAdaptiveRate", Cmd.PersistentFlags().Lookup("adaptive-rate"))
+	viper.BindPFlag("PingScanInterface", Cmd.PersistentFlags().Lookup("interface"))
+	viper.BindPFlag("PingScanSourceAddress", Cmd.PersistentFlags().Lookup("source"))
+	viper.BindPFlag("PingScanProbe", Cmd.PersistentFlags().Lookup("probe"))
+	viper.BindPFlag("PingScanTCPPorts", Cmd.PersistentFlags().Lookup("tcp-ports"))
+	viper.BindPFlag("PingScanUDPPorts", Cmd.PersistentFlags().Lookup("udp-ports"))
 	viper.BindPFlag("ScanTargetNetwork", Cmd.PersistentFlags().Lookup("network"))
+	viper.BindPFlag("PingScanSeed", Cmd.PersistentFlags().Lookup("seed"))
 	Cmd.AddCommand(discoverCmd)
 	Cmd.AddCommand(aliasCmd)
+	Cmd.AddCommand(replayCmd)
+	Cmd.AddCommand(traceCmd)
+	Cmd.AddCommand(localCmd)
 }
 
 var scanLongDesc = strings.TrimSpace(`
 The scanning utilities of IPv666 include (1) scanning a target network range (or 
-the global IPv6 address space) for live hosts over IPv6 and (2) determining whether 
-or not a target network range is an aliased network range.
+the global IPv6 address space) for live hosts over IPv6, (2) determining whether 
+or not a target network range is an aliased network range, (3) tracing the routes 
+to addresses to discover the routers along the way, and (4) finding the hosts on 
+an attached link.
 `)
 
 var Cmd = &cobra.Command{
@@ -39,6 +68,18 @@ var Cmd = &cobra.Command{
 			logging.ErrorF(err)
 		}
 
+		if err := validation.ValidateScanRate(viper.GetFloat64("PingScanRate")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateScanBinding(viper.GetString("PingScanInterface"), viper.GetString("PingScanSourceAddress")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateScanProbe(viper.GetString("PingScanProbe"), viper.GetString("PingScanTCPPorts"), viper.GetString("PingScanUDPPorts")); err != nil {
+			logging.ErrorF(err)
+		}
+
 		targetNetwork := viper.GetString("ScanTargetNetwork")
 
 		if err := validation.ValidateIPv6NetworkString(targetNetwork); err != nil {
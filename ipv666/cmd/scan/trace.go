@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"github.com/lavalamp-/ipv666/internal/app"
+	"github.com/lavalamp-/ipv666/internal/logging"
+	"github.com/lavalamp-/ipv666/internal/validation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+func init() {
+	var inputPath string
+	var genCount int
+	var maxHops int
+	traceCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "A file of IPv6 addresses to trace the routes to (if empty, candidate addresses are generated within the target network).")
+	traceCmd.PersistentFlags().IntVarP(&genCount, "count", "c", viper.GetInt("TraceGenerateCount"), "The number of candidate addresses to generate and trace when no input file is given.")
+	traceCmd.PersistentFlags().IntVar(&maxHops, "max-hops", viper.GetInt("TraceMaxHops"), "The highest hop limit to send probes with.")
+	viper.BindPFlag("TraceGenerateCount", traceCmd.PersistentFlags().Lookup("count"))
+	viper.BindPFlag("TraceMaxHops", traceCmd.PersistentFlags().Lookup("max-hops"))
+}
+
+var traceLongDesc = strings.TrimSpace(`
+This utility discovers the topology of a network by tracing the routes to a list of addresses
+(or to candidate addresses generated within the target network range). Each address is sent
+one probe for every hop limit up to the maximum, and the routers that answer with Time Exceeded
+errors are recorded along with the path to each address. Router addresses make good seeds for
+discovery as, unlike end hosts, they are rarely in aliased network ranges.
+`)
+
+var traceCmd = &cobra.Command{
+	Use:			"trace",
+	Short:			"Discover routers by tracing the routes to addresses",
+	Long:			traceLongDesc,
+	PreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if inputPath != "" {
+			if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+			}
+		} else if viper.GetInt("TraceGenerateCount") <= 0 {
+			logging.ErrorStringFf("You must supply a generate count of greater than zero (got %d).", viper.GetInt("TraceGenerateCount"))
+		}
+
+		if err := validation.ValidateTraceHops(viper.GetInt("TraceMaxHops")); err != nil {
+			logging.ErrorF(err)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		app.RunTrace(inputPath, viper.GetInt("TraceGenerateCount"))
+	},
+}